@@ -0,0 +1,293 @@
+package balancer
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sync"
+	"time"
+)
+
+// 可选的负载均衡策略名称 空字符串等同于加权随机
+const (
+	StrategyWeightedRandom   = "weighted_random"
+	StrategySmoothRoundRobin = "smooth_round_robin"
+	StrategyLeastInFlight    = "least_inflight"
+	StrategyLeastUsed        = "least_used"
+	StrategyLowestLatency    = "lowest_latency"
+	StrategyCheapest         = "cheapest"
+)
+
+// Strategies 全部可选策略
+var Strategies = []string{
+	StrategyWeightedRandom,
+	StrategySmoothRoundRobin,
+	StrategyLeastInFlight,
+	StrategyLeastUsed,
+	StrategyLowestLatency,
+	StrategyCheapest,
+}
+
+// ValidStrategy 判断策略名称是否有效
+func ValidStrategy(name string) bool {
+	if name == "" {
+		return true
+	}
+	for _, strategy := range Strategies {
+		if strategy == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Strategy 负载均衡策略 从候选项(key -> 权重)中选出一个
+// 候选集合由调用方在重试过程中增删 策略只负责在当前集合内选择
+type Strategy[T comparable] interface {
+	Select(items map[T]int) (T, error)
+}
+
+// WeightedRandomStrategy 按权重随机
+type WeightedRandomStrategy[T comparable] struct{}
+
+func (WeightedRandomStrategy[T]) Select(items map[T]int) (T, error) {
+	key, err := WeightedRandom(items)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return *key, nil
+}
+
+// SmoothRoundRobin 平滑加权轮询(nginx算法) 按权重比例均匀交错地选择
+type SmoothRoundRobin[T comparable] struct {
+	mu      sync.Mutex
+	current map[T]int
+}
+
+func NewSmoothRoundRobin[T comparable]() *SmoothRoundRobin[T] {
+	return &SmoothRoundRobin[T]{current: make(map[T]int)}
+}
+
+func (s *SmoothRoundRobin[T]) Select(items map[T]int) (T, error) {
+	var best T
+	if len(items) == 0 {
+		return best, fmt.Errorf("no provide items")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	total := 0
+	found := false
+	for key, weight := range items {
+		if weight <= 0 {
+			continue
+		}
+		total += weight
+		s.current[key] += weight
+		if !found || s.current[key] > s.current[best] {
+			best, found = key, true
+		}
+	}
+	if !found {
+		return best, fmt.Errorf("total provide weight must be greater than 0")
+	}
+	s.current[best] -= total
+	return best, nil
+}
+
+// InFlight 记录每个候选项正在处理的请求数
+type InFlight[T comparable] struct {
+	mu     sync.Mutex
+	counts map[T]int
+}
+
+func NewInFlight[T comparable]() *InFlight[T] {
+	return &InFlight[T]{counts: make(map[T]int)}
+}
+
+// Acquire 请求开始时调用
+func (f *InFlight[T]) Acquire(key T) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.counts[key]++
+}
+
+// Release 请求结束时调用
+func (f *InFlight[T]) Release(key T) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.counts[key] <= 1 {
+		delete(f.counts, key)
+		return
+	}
+	f.counts[key]--
+}
+
+// Count 返回正在处理的请求数
+func (f *InFlight[T]) Count(key T) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.counts[key]
+}
+
+// LeastInFlight 选择正在处理请求最少的候选项 按权重归一化 并列时加权随机
+type LeastInFlight[T comparable] struct {
+	InFlight *InFlight[T]
+}
+
+func (s LeastInFlight[T]) Select(items map[T]int) (T, error) {
+	return selectMin(items, func(key T) float64 {
+		return float64(s.InFlight.Count(key)) / float64(items[key])
+	})
+}
+
+// LeastUsed 选择用量最少的候选项 Usage返回各候选项的用量(如当日请求数)
+type LeastUsed[T comparable] struct {
+	Usage func(keys []T) (map[T]int64, error)
+}
+
+func (s LeastUsed[T]) Select(items map[T]int) (T, error) {
+	keys := make([]T, 0, len(items))
+	for key := range items {
+		keys = append(keys, key)
+	}
+	usage, err := s.Usage(keys)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return selectMin(items, func(key T) float64 {
+		return float64(usage[key]) / float64(items[key])
+	})
+}
+
+// Latency 记录每个候选项响应时间的指数加权移动平均
+type Latency[T comparable] struct {
+	mu    sync.Mutex
+	alpha float64
+	ewma  map[T]float64
+}
+
+// NewLatency alpha为新样本的权重 取值(0,1]
+func NewLatency[T comparable](alpha float64) *Latency[T] {
+	return &Latency[T]{alpha: alpha, ewma: make(map[T]float64)}
+}
+
+// Observe 记录一次响应时间
+func (l *Latency[T]) Observe(key T, d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	sample := float64(d)
+	if old, ok := l.ewma[key]; ok {
+		sample = l.alpha*sample + (1-l.alpha)*old
+	}
+	l.ewma[key] = sample
+}
+
+// Get 返回响应时间的移动平均 没有样本时ok为false
+func (l *Latency[T]) Get(key T) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	v, ok := l.ewma[key]
+	return time.Duration(v), ok
+}
+
+// LowestLatency 选择响应时间移动平均最低的候选项 没有样本的候选项优先 以便获得样本
+type LowestLatency[T comparable] struct {
+	Latency *Latency[T]
+}
+
+func (s LowestLatency[T]) Select(items map[T]int) (T, error) {
+	return selectMin(items, func(key T) float64 {
+		if d, ok := s.Latency.Get(key); ok {
+			return float64(d)
+		}
+		return -1
+	})
+}
+
+// Cheapest 选择预估费用最低的候选项 并列时加权随机
+type Cheapest[T comparable] struct {
+	Cost func(key T) float64
+}
+
+func (s Cheapest[T]) Select(items map[T]int) (T, error) {
+	return selectMin(items, s.Cost)
+}
+
+// ConsistentHash 按会话键做加权一致性哈希(rendezvous hashing) 同一会话在候选集合不变时总是选中同一候选项
+// 每个候选项的得分为 -权重/ln(hash) 得分最高者胜出 选中概率与权重成正比
+// 候选项增减或失败被移除时 只有原本落在该候选项上的会话会迁移到其他候选项
+type ConsistentHash[T comparable] struct {
+	Key string
+}
+
+func (s ConsistentHash[T]) Select(items map[T]int) (T, error) {
+	var best T
+	if len(items) == 0 {
+		return best, fmt.Errorf("no provide items")
+	}
+	bestScore := math.Inf(-1)
+	found := false
+	for key, weight := range items {
+		if weight <= 0 {
+			continue
+		}
+		h := fnv.New64a()
+		fmt.Fprintf(h, "%s\x00%v", s.Key, key)
+		// 映射到(0,1)开区间
+		u := (float64(mix64(h.Sum64())>>11) + 0.5) / (1 << 53)
+		score := -float64(weight) / math.Log(u)
+		if !found || score > bestScore {
+			best, bestScore, found = key, score, true
+		}
+	}
+	if !found {
+		return best, fmt.Errorf("total provide weight must be greater than 0")
+	}
+	return best, nil
+}
+
+// mix64 murmur3的fmix64 使仅末尾不同的输入的哈希高位也充分扩散
+func mix64(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+// selectMin 选择score最小的候选项 忽略权重不大于0的项 并列时按权重随机
+func selectMin[T comparable](items map[T]int, score func(key T) float64) (T, error) {
+	min := math.Inf(1)
+	ties := make(map[T]int)
+	for key, weight := range items {
+		if weight <= 0 {
+			continue
+		}
+		s := score(key)
+		switch {
+		case s < min:
+			min = s
+			clear(ties)
+			ties[key] = weight
+		case s == min:
+			ties[key] = weight
+		}
+	}
+	if len(ties) == 0 {
+		var zero T
+		if len(items) == 0 {
+			return zero, fmt.Errorf("no provide items")
+		}
+		return zero, fmt.Errorf("total provide weight must be greater than 0")
+	}
+	key, err := WeightedRandom(ties)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return *key, nil
+}
@@ -0,0 +1,124 @@
+package balancer
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSmoothRoundRobin(t *testing.T) {
+	rr := NewSmoothRoundRobin[string]()
+	items := map[string]int{"a": 5, "b": 1, "c": 1}
+	var order strings.Builder
+	for range 7 {
+		key, err := rr.Select(items)
+		if err != nil {
+			t.Fatalf("select: %v", err)
+		}
+		order.WriteString(key)
+	}
+	// nginx平滑加权轮询的经典序列
+	if got := order.String(); got != "aabacaa" && got != "aacabaa" {
+		t.Errorf("unexpected order %s", got)
+	}
+}
+
+func TestLeastInFlight(t *testing.T) {
+	inFlight := NewInFlight[int]()
+	inFlight.Acquire(1)
+	inFlight.Acquire(1)
+	inFlight.Acquire(2)
+	strategy := LeastInFlight[int]{InFlight: inFlight}
+
+	// 按权重归一化: 1为2/4 2为1/1
+	if key, _ := strategy.Select(map[int]int{1: 4, 2: 1}); key != 1 {
+		t.Errorf("expected 1, got %d", key)
+	}
+	inFlight.Release(1)
+	inFlight.Release(1)
+	if key, _ := strategy.Select(map[int]int{1: 1, 2: 1}); key != 1 {
+		t.Errorf("expected 1 after release, got %d", key)
+	}
+}
+
+func TestLeastUsed(t *testing.T) {
+	strategy := LeastUsed[int]{Usage: func(keys []int) (map[int]int64, error) {
+		return map[int]int64{1: 100, 2: 10, 3: 50}, nil
+	}}
+	if key, _ := strategy.Select(map[int]int{1: 1, 2: 1, 3: 1}); key != 2 {
+		t.Errorf("expected 2, got %d", key)
+	}
+}
+
+func TestCheapest(t *testing.T) {
+	costs := map[int]float64{1: 0.03, 2: 0.01, 3: 0.02}
+	strategy := Cheapest[int]{Cost: func(key int) float64 { return costs[key] }}
+	if key, _ := strategy.Select(map[int]int{1: 1, 2: 1, 3: 1}); key != 2 {
+		t.Errorf("expected 2, got %d", key)
+	}
+	// 最便宜的候选项被移除后选择次便宜的
+	if key, _ := strategy.Select(map[int]int{1: 1, 3: 1}); key != 3 {
+		t.Errorf("expected 3, got %d", key)
+	}
+}
+
+func TestLowestLatency(t *testing.T) {
+	latency := NewLatency[int](0.5)
+	latency.Observe(1, 100*time.Millisecond)
+	latency.Observe(2, 300*time.Millisecond)
+	latency.Observe(2, 100*time.Millisecond) // 移动平均为200ms
+	strategy := LowestLatency[int]{Latency: latency}
+
+	if key, _ := strategy.Select(map[int]int{1: 1, 2: 1}); key != 1 {
+		t.Errorf("expected 1, got %d", key)
+	}
+	// 没有样本的候选项优先
+	if key, _ := strategy.Select(map[int]int{1: 1, 2: 1, 3: 1}); key != 3 {
+		t.Errorf("expected unobserved 3, got %d", key)
+	}
+	if d, _ := latency.Get(2); d != 200*time.Millisecond {
+		t.Errorf("unexpected ewma %s", d)
+	}
+}
+
+func TestSelectEmpty(t *testing.T) {
+	if _, err := (WeightedRandomStrategy[int]{}).Select(nil); err == nil {
+		t.Error("expected error for empty items")
+	}
+	if _, err := NewSmoothRoundRobin[int]().Select(map[int]int{1: 0}); err == nil {
+		t.Error("expected error for zero weights")
+	}
+}
+
+func TestConsistentHash(t *testing.T) {
+	items := map[int]int{1: 1, 2: 1, 3: 2}
+	counts := map[int]int{}
+	moved := 0
+	for i := range 4000 {
+		strategy := ConsistentHash[int]{Key: "session-" + strconv.Itoa(i)}
+		key, err := strategy.Select(items)
+		if err != nil {
+			t.Fatalf("select: %v", err)
+		}
+		// 同一会话选择稳定
+		if again, _ := strategy.Select(items); again != key {
+			t.Fatalf("unstable choice for session %d", i)
+		}
+		counts[key]++
+
+		// 移除一个候选项后 只有落在它上面的会话迁移
+		without := map[int]int{1: 1, 2: 1}
+		next, _ := strategy.Select(without)
+		if key != 3 && next != key {
+			moved++
+		}
+	}
+	if moved != 0 {
+		t.Errorf("%d sessions moved although their provider was kept", moved)
+	}
+	// 按权重分布 3约占一半
+	if counts[3] < 1800 || counts[3] > 2200 || counts[1] < 800 || counts[2] < 800 {
+		t.Errorf("distribution does not follow weights: %v", counts)
+	}
+}
@@ -1,42 +1,69 @@
 package handler
 
 import (
+	"context"
+	"errors"
 	"log/slog"
+	"net/http"
 	"slices"
 	"strconv"
+	"time"
 
+	"github.com/atopos31/llmio/balancer"
 	"github.com/atopos31/llmio/common"
 	"github.com/atopos31/llmio/models"
 	"github.com/atopos31/llmio/providers"
+	"github.com/atopos31/llmio/service"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
 // ProviderRequest represents the request body for creating/updating a provider
 type ProviderRequest struct {
-	Name    string `json:"name"`
-	Type    string `json:"type"`
-	Config  string `json:"config"`
-	Console string `json:"console"`
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`
+	Config  string   `json:"config"`
+	Console string   `json:"console"`
+	Tags    []string `json:"tags"`
 }
 
 // ModelRequest represents the request body for creating/updating a model
 type ModelRequest struct {
-	Name     string `json:"name"`
-	Remark   string `json:"remark"`
-	MaxRetry int    `json:"max_retry"`
-	TimeOut  int    `json:"time_out"`
+	Name                string   `json:"name"`
+	Remark              string   `json:"remark"`
+	MaxRetry            int      `json:"max_retry"`
+	TimeOut             int      `json:"time_out"`
+	Strategy            string   `json:"strategy"`
+	Fallbacks           []string `json:"fallbacks"`
+	HedgeDelay          int      `json:"hedge_delay"`
+	Sticky              bool     `json:"sticky"`
+	ShadowProviderID    uint     `json:"shadow_provider_id"`
+	ShadowProviderModel string   `json:"shadow_provider_model"`
+	ShadowPercent       int      `json:"shadow_percent"`
 }
 
 // ModelWithProviderRequest represents the request body for creating/updating a model-provider association
 type ModelWithProviderRequest struct {
-	ModelID          uint   `json:"model_id"`
-	ProviderModel    string `json:"provider_name"`
-	ProviderID       uint   `json:"provider_id"`
-	ToolCall         bool   `json:"tool_call"`
-	StructuredOutput bool   `json:"structured_output"`
-	Image            bool   `json:"image"`
-	Weight           int    `json:"weight"`
+	ModelID          uint     `json:"model_id"`
+	ProviderModel    string   `json:"provider_name"`
+	ProviderID       uint     `json:"provider_id"`
+	ToolCall         bool     `json:"tool_call"`
+	StructuredOutput bool     `json:"structured_output"`
+	Image            bool     `json:"image"`
+	Weight           int      `json:"weight"`
+	Priority         int      `json:"priority"`
+	RPMLimit         int      `json:"rpm_limit"`
+	TPMLimit         int      `json:"tpm_limit"`
+	MaxConcurrency   int      `json:"max_concurrency"`
+	ContextWindow    int      `json:"context_window"`
+	MaxOutputTokens  int      `json:"max_output_tokens"`
+	InputPrice       float64  `json:"input_price"`
+	OutputPrice      float64  `json:"output_price"`
+	CachedPrice      *float64 `json:"cached_price"` // 为空表示按输入价格计
+
+	Canary            bool `json:"canary"`
+	CanaryPercent     int  `json:"canary_percent"`
+	CanaryRampMinutes int  `json:"canary_ramp_minutes"`
 }
 
 // SystemConfigRequest represents the request body for updating system configuration
@@ -46,6 +73,13 @@ type SystemConfigRequest struct {
 	ResponseTimeWeight  float64 `json:"response_time_weight"`
 	DecayThresholdHours int     `json:"decay_threshold_hours"`
 	MinWeight           int     `json:"min_weight"`
+	QueueSize           *int    `json:"queue_size"` // 未传入时保持不变
+
+	QueuePriorities map[string]int `json:"queue_priorities"` // 未传入时保持不变
+
+	CanaryMaxErrorRateDelta *float64 `json:"canary_max_error_rate_delta"` // 未传入时保持不变
+	CanaryMaxTTFTRatio      *float64 `json:"canary_max_ttft_ratio"`       // 未传入时保持不变
+	CanaryMinSamples        *int     `json:"canary_min_samples"`          // 未传入时保持不变
 }
 
 // GetProviders 获取所有提供商列表
@@ -104,6 +138,7 @@ func CreateProvider(c *gin.Context) {
 		Type:    req.Type,
 		Config:  req.Config,
 		Console: req.Console,
+		Tags:    req.Tags,
 	}
 
 	if err := gorm.G[models.Provider](models.DB).Create(c.Request.Context(), &provider); err != nil {
@@ -139,12 +174,16 @@ func UpdateProvider(c *gin.Context) {
 		return
 	}
 
-	// Update fields
+	// Update fields 标签为空时写入空数组以便清除
+	if req.Tags == nil {
+		req.Tags = []string{}
+	}
 	updates := models.Provider{
 		Name:    req.Name,
 		Type:    req.Type,
 		Config:  req.Config,
 		Console: req.Console,
+		Tags:    req.Tags,
 	}
 
 	if _, err := gorm.G[models.Provider](models.DB).Where("id = ?", id).Updates(c.Request.Context(), updates); err != nil {
@@ -221,11 +260,36 @@ func CreateModel(c *gin.Context) {
 		return
 	}
 
+	if !balancer.ValidStrategy(req.Strategy) {
+		common.BadRequest(c, "Invalid strategy: "+req.Strategy)
+		return
+	}
+	if err := validateFallbacks(req.Name, req.Fallbacks); err != nil {
+		common.BadRequest(c, err.Error())
+		return
+	}
+	if req.HedgeDelay < 0 {
+		common.BadRequest(c, "hedge_delay must be non-negative")
+		return
+	}
+	if err := validateShadow(c.Request.Context(), req); err != nil {
+		common.BadRequest(c, err.Error())
+		return
+	}
+
 	model := models.Model{
-		Name:     req.Name,
-		Remark:   req.Remark,
-		MaxRetry: req.MaxRetry,
-		TimeOut:  req.TimeOut,
+		Name:       req.Name,
+		Remark:     req.Remark,
+		MaxRetry:   req.MaxRetry,
+		TimeOut:    req.TimeOut,
+		Strategy:   req.Strategy,
+		Fallbacks:  req.Fallbacks,
+		HedgeDelay: req.HedgeDelay,
+		Sticky:     req.Sticky,
+
+		ShadowProviderID:    req.ShadowProviderID,
+		ShadowProviderModel: req.ShadowProviderModel,
+		ShadowPercent:       req.ShadowPercent,
 	}
 
 	if err := gorm.G[models.Model](models.DB).Create(c.Request.Context(), &model); err != nil {
@@ -251,6 +315,23 @@ func UpdateModel(c *gin.Context) {
 		return
 	}
 
+	if !balancer.ValidStrategy(req.Strategy) {
+		common.BadRequest(c, "Invalid strategy: "+req.Strategy)
+		return
+	}
+	if err := validateFallbacks(req.Name, req.Fallbacks); err != nil {
+		common.BadRequest(c, err.Error())
+		return
+	}
+	if req.HedgeDelay < 0 {
+		common.BadRequest(c, "hedge_delay must be non-negative")
+		return
+	}
+	if err := validateShadow(c.Request.Context(), req); err != nil {
+		common.BadRequest(c, err.Error())
+		return
+	}
+
 	// Check if model exists
 	_, err = gorm.G[models.Model](models.DB).Where("id = ?", id).First(c.Request.Context())
 	if err != nil {
@@ -262,18 +343,51 @@ func UpdateModel(c *gin.Context) {
 		return
 	}
 
-	// Update fields
+	// Update fields 回退列表为空时写入空数组以便清除
+	if req.Fallbacks == nil {
+		req.Fallbacks = []string{}
+	}
 	updates := models.Model{
-		Name:     req.Name,
-		Remark:   req.Remark,
-		MaxRetry: req.MaxRetry,
-		TimeOut:  req.TimeOut,
+		Name:       req.Name,
+		Remark:     req.Remark,
+		MaxRetry:   req.MaxRetry,
+		TimeOut:    req.TimeOut,
+		Strategy:   req.Strategy,
+		Fallbacks:  req.Fallbacks,
+		HedgeDelay: req.HedgeDelay,
+		Sticky:     req.Sticky,
+
+		ShadowProviderID:    req.ShadowProviderID,
+		ShadowProviderModel: req.ShadowProviderModel,
+		ShadowPercent:       req.ShadowPercent,
 	}
 
 	if _, err := gorm.G[models.Model](models.DB).Where("id = ?", id).Updates(c.Request.Context(), updates); err != nil {
 		common.InternalServerError(c, "Failed to update model: "+err.Error())
 		return
 	}
+	// 空策略表示恢复默认 对冲与粘性路由可以被关闭 Updates会忽略零值 需单独写入
+	if _, err := gorm.G[models.Model](models.DB).Where("id = ?", id).Update(c.Request.Context(), "strategy", req.Strategy); err != nil {
+		common.InternalServerError(c, "Failed to update model: "+err.Error())
+		return
+	}
+	if _, err := gorm.G[models.Model](models.DB).Where("id = ?", id).Update(c.Request.Context(), "hedge_delay", req.HedgeDelay); err != nil {
+		common.InternalServerError(c, "Failed to update model: "+err.Error())
+		return
+	}
+	if _, err := gorm.G[models.Model](models.DB).Where("id = ?", id).Update(c.Request.Context(), "sticky", req.Sticky); err != nil {
+		common.InternalServerError(c, "Failed to update model: "+err.Error())
+		return
+	}
+	// 影子流量可以被关闭
+	if err := models.DB.WithContext(c.Request.Context()).Model(&models.Model{}).Where("id = ?", id).Updates(map[string]any{
+		"shadow_provider_id":    req.ShadowProviderID,
+		"shadow_provider_model": req.ShadowProviderModel,
+		"shadow_percent":        req.ShadowPercent,
+	}).Error; err != nil {
+		common.InternalServerError(c, "Failed to update model: "+err.Error())
+		return
+	}
 
 	// Get updated model
 	updatedModel, err := gorm.G[models.Model](models.DB).Where("id = ?", id).First(c.Request.Context())
@@ -285,6 +399,66 @@ func UpdateModel(c *gin.Context) {
 	common.Success(c, updatedModel)
 }
 
+// validateShadow 开启影子流量时目标提供商必须存在 且需指定模型名称
+func validateShadow(ctx context.Context, req ModelRequest) error {
+	if req.ShadowPercent < 0 || req.ShadowPercent > 100 {
+		return errors.New("shadow_percent must be between 0 and 100")
+	}
+	if req.ShadowProviderID == 0 {
+		return nil
+	}
+	if req.ShadowProviderModel == "" {
+		return errors.New("shadow_provider_model is required when shadow_provider_id is set")
+	}
+	if _, err := gorm.G[models.Provider](models.DB).Where("id = ?", req.ShadowProviderID).First(ctx); err != nil {
+		return errors.New("shadow provider not found")
+	}
+	return nil
+}
+
+// validateFallbacks 回退模型不能为空 不能重复 也不能是模型自身
+func validateFallbacks(name string, fallbacks []string) error {
+	seen := make(map[string]bool, len(fallbacks))
+	for _, fallback := range fallbacks {
+		if fallback == "" {
+			return errors.New("fallback model name is empty")
+		}
+		if fallback == name {
+			return errors.New("model cannot fall back to itself: " + name)
+		}
+		if seen[fallback] {
+			return errors.New("duplicate fallback model: " + fallback)
+		}
+		seen[fallback] = true
+	}
+	return nil
+}
+
+// GetModelShadowComparison 对比模型最近hours小时(默认24)内的主请求与影子请求
+func GetModelShadowComparison(c *gin.Context) {
+	hours, err := strconv.Atoi(c.DefaultQuery("hours", "24"))
+	if err != nil || hours < 1 {
+		common.BadRequest(c, "Invalid hours parameter")
+		return
+	}
+	model, err := gorm.G[models.Model](models.DB).Where("id = ?", c.Param("id")).First(c.Request.Context())
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			common.NotFound(c, "Model not found")
+			return
+		}
+		common.InternalServerError(c, "Database error: "+err.Error())
+		return
+	}
+
+	comparison, err := service.CompareShadow(c.Request.Context(), model.Name, time.Now().Add(-time.Duration(hours)*time.Hour))
+	if err != nil {
+		common.InternalServerError(c, "Failed to compare shadow traffic: "+err.Error())
+		return
+	}
+	common.Success(c, comparison)
+}
+
 // DeleteModel 删除模型
 func DeleteModel(c *gin.Context) {
 	idStr := c.Param("id")
@@ -330,6 +504,30 @@ type ProviderTemplate struct {
 			"version": "2023-06-01"
 		}`,
 	},
+	{
+		Type: "azure",
+		Template: `{
+			"base_url": "https://YOUR_RESOURCE.openai.azure.com",
+			"api_key": "YOUR_API_KEY",
+			"api_version": "2024-10-21"
+		}`,
+	},
+	{
+		Type: "bedrock",
+		Template: `{
+			"region": "us-east-1",
+			"access_key_id": "YOUR_ACCESS_KEY_ID",
+			"secret_access_key": "YOUR_SECRET_ACCESS_KEY",
+			"session_token": ""
+		}`,
+	},
+	{
+		Type: "gemini",
+		Template: `{
+			"base_url": "https://generativelanguage.googleapis.com/v1beta",
+			"api_key": "YOUR_API_KEY"
+		}`,
+	},
 }
 
 func GetProviderTemplates(c *gin.Context) {
@@ -404,6 +602,43 @@ func GetModelProviderStatus(c *gin.Context) {
 	common.Success(c, status)
 }
 
+// GetModelProviderUtilization 获取各模型提供商关联的网关侧限额使用情况
+func GetModelProviderUtilization(c *gin.Context) {
+	ctx := c.Request.Context()
+	associations, err := gorm.G[models.ModelWithProvider](models.DB).Find(ctx)
+	if err != nil {
+		common.InternalServerError(c, err.Error())
+		return
+	}
+	llmModels, err := gorm.G[models.Model](models.DB).Find(ctx)
+	if err != nil {
+		common.InternalServerError(c, err.Error())
+		return
+	}
+	llmProviders, err := gorm.G[models.Provider](models.DB).Find(ctx)
+	if err != nil {
+		common.InternalServerError(c, err.Error())
+		return
+	}
+	modelNames := make(map[uint]string, len(llmModels))
+	for _, model := range llmModels {
+		modelNames[model.ID] = model.Name
+	}
+	providerNames := make(map[uint]string, len(llmProviders))
+	for _, provider := range llmProviders {
+		providerNames[provider.ID] = provider.Name
+	}
+
+	utilizations := make([]service.Utilization, 0, len(associations))
+	for _, association := range associations {
+		utilization := service.GetUtilization(association)
+		utilization.ModelName = modelNames[association.ModelID]
+		utilization.ProviderName = providerNames[association.ProviderID]
+		utilizations = append(utilizations, utilization)
+	}
+	common.Success(c, utilizations)
+}
+
 // CreateModelProvider 创建模型提供商关联
 func CreateModelProvider(c *gin.Context) {
 	var req ModelWithProviderRequest
@@ -411,6 +646,22 @@ func CreateModelProvider(c *gin.Context) {
 		common.BadRequest(c, "Invalid request body: "+err.Error())
 		return
 	}
+	if req.RPMLimit < 0 || req.TPMLimit < 0 || req.MaxConcurrency < 0 {
+		common.BadRequest(c, "rpm_limit, tpm_limit and max_concurrency must be non-negative")
+		return
+	}
+	if req.ContextWindow < 0 || req.MaxOutputTokens < 0 {
+		common.BadRequest(c, "context_window and max_output_tokens must be non-negative")
+		return
+	}
+	if req.InputPrice < 0 || req.OutputPrice < 0 || (req.CachedPrice != nil && *req.CachedPrice < 0) {
+		common.BadRequest(c, "input_price, output_price and cached_price must be non-negative")
+		return
+	}
+	if req.Canary && (req.CanaryPercent < 1 || req.CanaryPercent > 100 || req.CanaryRampMinutes < 1) {
+		common.BadRequest(c, "canary_percent must be between 1 and 100 and canary_ramp_minutes must be positive")
+		return
+	}
 
 	modelProvider := models.ModelWithProvider{
 		ModelID:          req.ModelID,
@@ -420,6 +671,23 @@ func CreateModelProvider(c *gin.Context) {
 		StructuredOutput: &req.StructuredOutput,
 		Image:            &req.Image,
 		Weight:           req.Weight,
+		Priority:         req.Priority,
+		RPMLimit:         req.RPMLimit,
+		TPMLimit:         req.TPMLimit,
+		MaxConcurrency:   req.MaxConcurrency,
+		ContextWindow:    req.ContextWindow,
+		MaxOutputTokens:  req.MaxOutputTokens,
+		InputPrice:       req.InputPrice,
+		OutputPrice:      req.OutputPrice,
+		CachedPrice:      req.CachedPrice,
+
+		Canary:            req.Canary,
+		CanaryPercent:     req.CanaryPercent,
+		CanaryRampMinutes: req.CanaryRampMinutes,
+	}
+	if req.Canary {
+		now := time.Now()
+		modelProvider.CanaryStartedAt = &now
 	}
 
 	err := gorm.G[models.ModelWithProvider](models.DB).Create(c.Request.Context(), &modelProvider)
@@ -427,6 +695,11 @@ func CreateModelProvider(c *gin.Context) {
 		common.InternalServerError(c, "Failed to create model-provider association: "+err.Error())
 		return
 	}
+	if req.Canary {
+		if err := service.RecordCanaryEvent(c.Request.Context(), models.CanaryEvent{ModelWithProviderID: modelProvider.ID, Event: service.CanaryStarted}); err != nil {
+			slog.Error("save canary event error", "error", err)
+		}
+	}
 
 	common.Success(c, modelProvider)
 }
@@ -445,10 +718,26 @@ func UpdateModelProvider(c *gin.Context) {
 		common.BadRequest(c, "Invalid request body: "+err.Error())
 		return
 	}
+	if req.RPMLimit < 0 || req.TPMLimit < 0 || req.MaxConcurrency < 0 {
+		common.BadRequest(c, "rpm_limit, tpm_limit and max_concurrency must be non-negative")
+		return
+	}
+	if req.ContextWindow < 0 || req.MaxOutputTokens < 0 {
+		common.BadRequest(c, "context_window and max_output_tokens must be non-negative")
+		return
+	}
+	if req.InputPrice < 0 || req.OutputPrice < 0 || (req.CachedPrice != nil && *req.CachedPrice < 0) {
+		common.BadRequest(c, "input_price, output_price and cached_price must be non-negative")
+		return
+	}
+	if req.Canary && (req.CanaryPercent < 1 || req.CanaryPercent > 100 || req.CanaryRampMinutes < 1) {
+		common.BadRequest(c, "canary_percent must be between 1 and 100 and canary_ramp_minutes must be positive")
+		return
+	}
 	slog.Info("UpdateModelProvider", "req", req)
 
 	// Check if model-provider association exists
-	_, err = gorm.G[models.ModelWithProvider](models.DB).Where("id = ?", id).First(c.Request.Context())
+	current, err := gorm.G[models.ModelWithProvider](models.DB).Where("id = ?", id).First(c.Request.Context())
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			common.NotFound(c, "Model-provider association not found")
@@ -473,6 +762,35 @@ func UpdateModelProvider(c *gin.Context) {
 		common.InternalServerError(c, "Failed to update model-provider association: "+err.Error())
 		return
 	}
+	// 优先级、限额、上下文窗口、价格与灰度设置可以被置为0 Updates会忽略零值 需单独写入
+	fields := map[string]any{
+		"priority":            req.Priority,
+		"rpm_limit":           req.RPMLimit,
+		"tpm_limit":           req.TPMLimit,
+		"max_concurrency":     req.MaxConcurrency,
+		"context_window":      req.ContextWindow,
+		"max_output_tokens":   req.MaxOutputTokens,
+		"input_price":         req.InputPrice,
+		"output_price":        req.OutputPrice,
+		"cached_price":        req.CachedPrice,
+		"canary":              req.Canary,
+		"canary_percent":      req.CanaryPercent,
+		"canary_ramp_minutes": req.CanaryRampMinutes,
+	}
+	// 新开启灰度时从当前时间开始放量
+	startCanary := req.Canary && !current.Canary
+	if startCanary {
+		fields["canary_started_at"] = time.Now()
+	}
+	if err := models.DB.WithContext(c.Request.Context()).Model(&models.ModelWithProvider{}).Where("id = ?", id).Updates(fields).Error; err != nil {
+		common.InternalServerError(c, "Failed to update model-provider association: "+err.Error())
+		return
+	}
+	if startCanary {
+		if err := service.RecordCanaryEvent(c.Request.Context(), models.CanaryEvent{ModelWithProviderID: uint(id), Event: service.CanaryStarted}); err != nil {
+			slog.Error("save canary event error", "error", err)
+		}
+	}
 
 	// Get updated model-provider association
 	updatedModelProvider, err := gorm.G[models.ModelWithProvider](models.DB).Where("id = ?", id).First(c.Request.Context())
@@ -507,6 +825,202 @@ func DeleteModelProvider(c *gin.Context) {
 	common.Success(c, nil)
 }
 
+// GetModelProviderCanaryEvents 获取关联的灰度事件 按时间倒序
+func GetModelProviderCanaryEvents(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		common.BadRequest(c, "Invalid ID format")
+		return
+	}
+
+	events, err := gorm.G[models.CanaryEvent](models.DB).Where("model_with_provider_id = ?", id).Order("id DESC").Find(c.Request.Context())
+	if err != nil {
+		common.InternalServerError(c, err.Error())
+		return
+	}
+
+	common.Success(c, events)
+}
+
+// RoutingRuleRequest represents the request body for creating/updating a routing rule
+type RoutingRuleRequest struct {
+	Name     string `json:"name"`
+	Enabled  bool   `json:"enabled"`
+	Priority int    `json:"priority"`
+
+	Headers      map[string]string `json:"headers"`
+	APIKeys      []string          `json:"api_keys"`
+	ModelPattern string            `json:"model_pattern"`
+	Stream       *bool             `json:"stream"`
+	ToolCall     *bool             `json:"tool_call"`
+	Image        *bool             `json:"image"`
+
+	IncludeTags      []string `json:"include_tags"`
+	ExcludeTags      []string `json:"exclude_tags"`
+	ExcludeProviders []uint   `json:"exclude_providers"`
+	Strategy         string   `json:"strategy"`
+}
+
+func (req RoutingRuleRequest) rule() models.RoutingRule {
+	return models.RoutingRule{
+		Name:             req.Name,
+		Enabled:          req.Enabled,
+		Priority:         req.Priority,
+		Headers:          req.Headers,
+		APIKeys:          req.APIKeys,
+		ModelPattern:     req.ModelPattern,
+		Stream:           req.Stream,
+		ToolCall:         req.ToolCall,
+		Image:            req.Image,
+		IncludeTags:      req.IncludeTags,
+		ExcludeTags:      req.ExcludeTags,
+		ExcludeProviders: req.ExcludeProviders,
+		Strategy:         req.Strategy,
+	}
+}
+
+// RoutingRuleEvaluateRequest 路由规则试运行的模拟请求
+type RoutingRuleEvaluateRequest struct {
+	Model    string            `json:"model"`
+	Headers  map[string]string `json:"headers"`
+	APIKey   string            `json:"api_key"`
+	Stream   bool              `json:"stream"`
+	ToolCall bool              `json:"tool_call"`
+	Image    bool              `json:"image"`
+}
+
+// GetRoutingRules 获取所有路由规则 按匹配顺序排列
+func GetRoutingRules(c *gin.Context) {
+	rules, err := gorm.G[models.RoutingRule](models.DB).Order("priority DESC, id ASC").Find(c.Request.Context())
+	if err != nil {
+		common.InternalServerError(c, err.Error())
+		return
+	}
+
+	common.Success(c, rules)
+}
+
+// CreateRoutingRule 创建路由规则
+func CreateRoutingRule(c *gin.Context) {
+	var req RoutingRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.BadRequest(c, "Invalid request body: "+err.Error())
+		return
+	}
+	rule := req.rule()
+	if err := service.ValidateRule(rule); err != nil {
+		common.BadRequest(c, err.Error())
+		return
+	}
+
+	if err := gorm.G[models.RoutingRule](models.DB).Create(c.Request.Context(), &rule); err != nil {
+		common.InternalServerError(c, "Failed to create routing rule: "+err.Error())
+		return
+	}
+	service.InvalidateRules()
+
+	common.Success(c, rule)
+}
+
+// UpdateRoutingRule 更新路由规则
+func UpdateRoutingRule(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		common.BadRequest(c, "Invalid ID format")
+		return
+	}
+
+	var req RoutingRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.BadRequest(c, "Invalid request body: "+err.Error())
+		return
+	}
+	rule := req.rule()
+	if err := service.ValidateRule(rule); err != nil {
+		common.BadRequest(c, err.Error())
+		return
+	}
+
+	current, err := gorm.G[models.RoutingRule](models.DB).Where("id = ?", id).First(c.Request.Context())
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			common.NotFound(c, "Routing rule not found")
+			return
+		}
+		common.InternalServerError(c, "Database error: "+err.Error())
+		return
+	}
+
+	// Save会写入零值(如停用规则或清除条件)
+	rule.Model = current.Model
+	if err := models.DB.WithContext(c.Request.Context()).Save(&rule).Error; err != nil {
+		common.InternalServerError(c, "Failed to update routing rule: "+err.Error())
+		return
+	}
+	service.InvalidateRules()
+
+	common.Success(c, rule)
+}
+
+// DeleteRoutingRule 删除路由规则
+func DeleteRoutingRule(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		common.BadRequest(c, "Invalid ID format")
+		return
+	}
+
+	result, err := gorm.G[models.RoutingRule](models.DB).Where("id = ?", id).Delete(c.Request.Context())
+	if err != nil {
+		common.InternalServerError(c, "Failed to delete routing rule: "+err.Error())
+		return
+	}
+
+	if result == 0 {
+		common.NotFound(c, "Routing rule not found")
+		return
+	}
+	service.InvalidateRules()
+
+	common.Success(c, nil)
+}
+
+// EvaluateRoutingRules 对模拟请求试运行路由规则 不发送请求
+func EvaluateRoutingRules(c *gin.Context) {
+	var req RoutingRuleEvaluateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.BadRequest(c, "Invalid request body: "+err.Error())
+		return
+	}
+	if req.Model == "" {
+		common.BadRequest(c, "model is required")
+		return
+	}
+
+	header := make(http.Header, len(req.Headers))
+	for name, value := range req.Headers {
+		header.Set(name, value)
+	}
+	result, err := service.DryRunRules(c.Request.Context(), service.RuleInput{
+		Model:    req.Model,
+		Header:   header,
+		APIKey:   req.APIKey,
+		Stream:   req.Stream,
+		ToolCall: req.ToolCall,
+		Image:    req.Image,
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			common.NotFound(c, "Model not found")
+			return
+		}
+		common.InternalServerError(c, err.Error())
+		return
+	}
+
+	common.Success(c, result)
+}
+
 // GetRequestLogs 获取最近的请求日志（支持分页和筛选）
 func GetRequestLogs(c *gin.Context) {
 	// 分页参数
@@ -585,12 +1099,10 @@ func GetRequestLogs(c *gin.Context) {
 
 // GetSystemConfig 获取系统配置
 func GetSystemConfig(c *gin.Context) {
-	config := map[string]interface{}{
-		"enable_smart_routing":  true,
-		"success_rate_weight":   0.7,
-		"response_time_weight":  0.3,
-		"decay_threshold_hours": 24,
-		"min_weight":            1,
+	config, err := service.GetSystemConfig(c.Request.Context())
+	if err != nil {
+		common.InternalServerError(c, "Failed to get system config: "+err.Error())
+		return
 	}
 
 	common.Success(c, config)
@@ -604,12 +1116,67 @@ func UpdateSystemConfig(c *gin.Context) {
 		return
 	}
 
-	config := map[string]interface{}{
-		"enable_smart_routing":  req.EnableSmartRouting,
-		"success_rate_weight":   req.SuccessRateWeight,
-		"response_time_weight":  req.ResponseTimeWeight,
-		"decay_threshold_hours": req.DecayThresholdHours,
-		"min_weight":            req.MinWeight,
+	if req.SuccessRateWeight < 0 || req.ResponseTimeWeight < 0 || req.SuccessRateWeight+req.ResponseTimeWeight <= 0 {
+		common.BadRequest(c, "success_rate_weight and response_time_weight must be non-negative and not both zero")
+		return
+	}
+	if req.DecayThresholdHours < 1 {
+		common.BadRequest(c, "decay_threshold_hours must be at least 1")
+		return
+	}
+	if req.MinWeight < 0 {
+		common.BadRequest(c, "min_weight must be non-negative")
+		return
+	}
+	if req.QueueSize != nil && *req.QueueSize < 0 {
+		common.BadRequest(c, "queue_size must be non-negative")
+		return
+	}
+	if (req.CanaryMaxErrorRateDelta != nil && *req.CanaryMaxErrorRateDelta < 0) ||
+		(req.CanaryMaxTTFTRatio != nil && *req.CanaryMaxTTFTRatio < 0) ||
+		(req.CanaryMinSamples != nil && *req.CanaryMinSamples < 0) {
+		common.BadRequest(c, "canary_max_error_rate_delta, canary_max_ttft_ratio and canary_min_samples must be non-negative")
+		return
+	}
+
+	current, err := service.GetSystemConfig(c.Request.Context())
+	if err != nil {
+		common.InternalServerError(c, "Failed to get system config: "+err.Error())
+		return
+	}
+	update := models.SystemConfig{
+		EnableSmartRouting:  req.EnableSmartRouting,
+		SuccessRateWeight:   req.SuccessRateWeight,
+		ResponseTimeWeight:  req.ResponseTimeWeight,
+		DecayThresholdHours: req.DecayThresholdHours,
+		MinWeight:           req.MinWeight,
+		QueueSize:           current.QueueSize,
+		QueuePriorities:     current.QueuePriorities,
+
+		CanaryMaxErrorRateDelta: current.CanaryMaxErrorRateDelta,
+		CanaryMaxTTFTRatio:      current.CanaryMaxTTFTRatio,
+		CanaryMinSamples:        current.CanaryMinSamples,
+	}
+	if req.QueueSize != nil {
+		update.QueueSize = *req.QueueSize
+	}
+	if req.QueuePriorities != nil {
+		update.QueuePriorities = req.QueuePriorities
+	}
+	if req.CanaryMaxErrorRateDelta != nil {
+		update.CanaryMaxErrorRateDelta = *req.CanaryMaxErrorRateDelta
+	}
+	if req.CanaryMaxTTFTRatio != nil {
+		update.CanaryMaxTTFTRatio = *req.CanaryMaxTTFTRatio
+	}
+	if req.CanaryMinSamples != nil {
+		update.CanaryMinSamples = *req.CanaryMinSamples
+	}
+
+	config, err := service.SaveSystemConfig(c.Request.Context(), update)
+	if err != nil {
+		common.InternalServerError(c, "Failed to update system config: "+err.Error())
+		return
 	}
 
 	common.Success(c, config)
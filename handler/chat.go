@@ -1,7 +1,10 @@
 package handler
 
 import (
+	"errors"
 	"log/slog"
+	"net/http"
+	"strconv"
 
 	"github.com/atopos31/llmio/common"
 	"github.com/atopos31/llmio/models"
@@ -34,16 +37,50 @@ func ModelsHandler(c *gin.Context) {
 	})
 }
 
+// balanceError 将负载均衡的错误写回客户端 请求体有误时返回400
+// 排队已满返回429 排队超时返回503 均附带Retry-After
+func balanceError(c *gin.Context, err error) {
+	if errors.Is(err, providers.ErrInvalidRequest) {
+		common.BadRequest(c, err.Error())
+		return
+	}
+	var queueErr *service.QueueError
+	if errors.As(err, &queueErr) {
+		status := http.StatusServiceUnavailable
+		if queueErr.Full {
+			status = http.StatusTooManyRequests
+		}
+		c.Header("Retry-After", strconv.Itoa(int(queueErr.RetryAfter.Seconds())))
+		common.ErrorWithHttpStatus(c, status, status, err.Error())
+		return
+	}
+	common.InternalServerError(c, err.Error())
+}
+
 func ChatCompletionsHandler(c *gin.Context) {
 	if err := service.BalanceChat(c, "openai", service.BeforerOpenAI, service.ProcesserOpenAI); err != nil {
-		common.InternalServerError(c, err.Error())
+		balanceError(c, err)
 		return
 	}
 }
 
 func Messages(c *gin.Context) {
 	if err := service.BalanceChat(c, "anthropic", service.BeforerAnthropic, service.ProcesserAnthropic); err != nil {
-		common.InternalServerError(c, err.Error())
+		balanceError(c, err)
+		return
+	}
+}
+
+func Responses(c *gin.Context) {
+	if err := service.BalanceChat(c, "responses", service.BeforerResponses, service.ProcesserResponses); err != nil {
+		balanceError(c, err)
+		return
+	}
+}
+
+func Embeddings(c *gin.Context) {
+	if err := service.BalanceChat(c, "embeddings", service.BeforerEmbeddings, service.ProcesserEmbeddings); err != nil {
+		balanceError(c, err)
 		return
 	}
 }
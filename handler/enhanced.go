@@ -1,12 +1,14 @@
 package handler
 
 import (
+	"cmp"
 	"context"
 	"encoding/csv"
 	"encoding/json"
 	"fmt"
 	"log/slog"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -38,6 +40,16 @@ type ProviderHealthStatus struct {
 	SuccessRate24h       float64    `json:"success_rate_24h"`
 	TotalRequests24h     int64      `json:"total_requests_24h"`
 	AvgResponseTime      float64    `json:"avg_response_time_ms"`
+	Keys                 []providers.KeyStatus `json:"keys,omitempty"` // 各API密钥的使用与冷却状态
+	Breakers             []ModelProviderBreaker `json:"breakers,omitempty"` // 各模型提供商关联的熔断器状态
+}
+
+// ModelProviderBreaker 模型提供商关联的熔断器状态
+type ModelProviderBreaker struct {
+	ModelProviderID uint   `json:"model_provider_id"`
+	ModelName       string `json:"model_name"`
+	ProviderModel   string `json:"provider_model"`
+	service.BreakerStatus
 }
 
 // DashboardStats 仪表板统计数据
@@ -50,8 +62,10 @@ type DashboardStats struct {
 	FailedRequests24h  int64   `json:"failed_requests_24h"`
 	AvgResponseTime    float64 `json:"avg_response_time_ms"`
 	TotalTokens24h     int64   `json:"total_tokens_24h"`
+	TotalCost24h       float64 `json:"total_cost_24h"`
 	TopModels          []ModelUsageStats `json:"top_models"`
 	TopProviders       []ProviderUsageStats `json:"top_providers"`
+	ProviderSpend      []ProviderUsageStats `json:"provider_spend"` // 全部提供商按费用从高到低
 }
 
 // ModelUsageStats 模型使用统计
@@ -60,6 +74,7 @@ type ModelUsageStats struct {
 	RequestCount  int64   `json:"request_count"`
 	SuccessRate   float64 `json:"success_rate"`
 	TotalTokens   int64   `json:"total_tokens"`
+	Cost          float64 `json:"cost"`
 	AvgResponseTime float64 `json:"avg_response_time_ms"`
 }
 
@@ -69,6 +84,7 @@ type ProviderUsageStats struct {
 	RequestCount  int64   `json:"request_count"`
 	SuccessRate   float64 `json:"success_rate"`
 	TotalTokens   int64   `json:"total_tokens"`
+	Cost          float64 `json:"cost"`
 	AvgResponseTime float64 `json:"avg_response_time_ms"`
 }
 
@@ -151,6 +167,20 @@ func checkProviderHealth(ctx context.Context, provider *models.Provider) Provide
 		status.LastChecked = validation.LastValidatedAt
 	}
 
+	// 各API密钥的状态
+	if keys, err := providers.KeyStatuses(provider.Config); err != nil {
+		slog.Warn("Failed to parse provider keys", "provider", provider.Name, "error", err)
+	} else {
+		status.Keys = keys
+	}
+
+	// 各模型提供商关联的熔断器状态
+	if breakers, err := providerBreakers(ctx, provider.ID); err != nil {
+		slog.Warn("Failed to get circuit breakers", "provider", provider.Name, "error", err)
+	} else {
+		status.Breakers = breakers
+	}
+
 	// 获取最近24小时的统计数据
 	since := time.Now().Add(-24 * time.Hour)
 	
@@ -158,7 +188,7 @@ func checkProviderHealth(ctx context.Context, provider *models.Provider) Provide
 	var avgResponseTime float64
 	
 	if err := models.DB.Model(&models.ChatLog{}).
-		Where("provider_name = ? AND created_at > ?", provider.Name, since).
+		Where("provider_name = ? AND created_at > ? AND status <> ?", provider.Name, since, "hedged").
 		Count(&total).Error; err != nil {
 		slog.Error("Failed to count total requests", "error", err)
 	}
@@ -194,7 +224,9 @@ func checkProviderHealth(ctx context.Context, provider *models.Provider) Provide
 		if status.ErrorMessage == "" {
 			status.ErrorMessage = "Low success rate in last 24h"
 		}
-	} else if status.ErrorCount > 0 {
+	} else if status.ErrorCount > 0 || slices.ContainsFunc(status.Breakers, func(b ModelProviderBreaker) bool {
+		return b.State != service.BreakerClosed
+	}) {
 		status.Status = "degraded"
 	} else {
 		status.Status = "healthy"
@@ -203,6 +235,37 @@ func checkProviderHealth(ctx context.Context, provider *models.Provider) Provide
 	return status
 }
 
+// providerBreakers 返回提供商下所有模型提供商关联的熔断器状态
+func providerBreakers(ctx context.Context, providerID uint) ([]ModelProviderBreaker, error) {
+	associations, err := gorm.G[models.ModelWithProvider](models.DB).Where("provider_id = ?", providerID).Find(ctx)
+	if err != nil {
+		return nil, err
+	}
+	modelIDs := make([]uint, 0, len(associations))
+	for _, association := range associations {
+		modelIDs = append(modelIDs, association.ModelID)
+	}
+	llmModels, err := gorm.G[models.Model](models.DB).Where("id IN ?", modelIDs).Find(ctx)
+	if err != nil {
+		return nil, err
+	}
+	modelNames := make(map[uint]string, len(llmModels))
+	for _, model := range llmModels {
+		modelNames[model.ID] = model.Name
+	}
+
+	breakers := make([]ModelProviderBreaker, 0, len(associations))
+	for _, association := range associations {
+		breakers = append(breakers, ModelProviderBreaker{
+			ModelProviderID: association.ID,
+			ModelName:       modelNames[association.ModelID],
+			ProviderModel:   association.ProviderModel,
+			BreakerStatus:   service.GetBreakerStatus(association.ID),
+		})
+	}
+	return breakers, nil
+}
+
 // GetDashboardStats 获取仪表板统计数据
 func GetDashboardStats(c *gin.Context) {
 	stats := DashboardStats{}
@@ -227,7 +290,7 @@ func GetDashboardStats(c *gin.Context) {
 
 	// 获取24小时内的请求统计
 	if err := models.DB.Model(&models.ChatLog{}).
-		Where("created_at > ?", since).
+		Where("created_at > ? AND status <> ?", since, "hedged").
 		Count(&stats.TotalRequests24h).Error; err != nil {
 		common.InternalServerError(c, "Failed to count total requests: "+err.Error())
 		return
@@ -251,15 +314,17 @@ func GetDashboardStats(c *gin.Context) {
 	}
 	stats.AvgResponseTime = stats.AvgResponseTime / float64(time.Millisecond)
 
-	// 获取总token数
+	// 获取总token数与总费用
 	var totalTokens int64
+	var totalCost float64
 	if err := models.DB.Model(&models.ChatLog{}).
-		Select("COALESCE(SUM(total_tokens), 0)").
-		Where("created_at > ?", since).
-		Row().Scan(&totalTokens); err != nil {
+		Select("COALESCE(SUM(total_tokens), 0), COALESCE(SUM(cost), 0)").
+		Where("created_at > ? AND status <> ?", since, "hedged").
+		Row().Scan(&totalTokens, &totalCost); err != nil {
 		slog.Error("Failed to get total tokens", "error", err)
 	}
 	stats.TotalTokens24h = totalTokens
+	stats.TotalCost24h = totalCost
 
 	// 获取Top 5模型
 	type ModelStats struct {
@@ -267,13 +332,14 @@ type ModelStats struct {
 		Total       int64
 		Success     int64
 		TotalTokens int64
+		Cost        float64
 		AvgTime     float64
 	}
 	
 	var modelStats []ModelStats
 	if err := models.DB.Model(&models.ChatLog{}).
-		Select("name, COUNT(*) as total, SUM(CASE WHEN status = 'success' THEN 1 ELSE 0 END) as success, COALESCE(SUM(total_tokens), 0) as total_tokens, AVG(proxy_time) as avg_time").
-		Where("created_at > ?", since).
+		Select("name, COUNT(*) as total, SUM(CASE WHEN status = 'success' THEN 1 ELSE 0 END) as success, COALESCE(SUM(total_tokens), 0) as total_tokens, COALESCE(SUM(cost), 0) as cost, AVG(proxy_time) as avg_time").
+		Where("created_at > ? AND status <> ?", since, "hedged").
 		Group("name").
 		Order("total DESC").
 		Limit(5).
@@ -292,6 +358,7 @@ type ModelStats struct {
 			RequestCount:    ms.Total,
 			SuccessRate:     successRate,
 			TotalTokens:     ms.TotalTokens,
+			Cost:            ms.Cost,
 			AvgResponseTime: ms.AvgTime / float64(time.Millisecond),
 		})
 	}
@@ -302,34 +369,40 @@ type ProviderStats struct {
 		Total       int64
 		Success     int64
 		TotalTokens int64
+		Cost        float64
 		AvgTime     float64
 	}
 	
 	var providerStats []ProviderStats
 	if err := models.DB.Model(&models.ChatLog{}).
-		Select("provider_name, COUNT(*) as total, SUM(CASE WHEN status = 'success' THEN 1 ELSE 0 END) as success, COALESCE(SUM(total_tokens), 0) as total_tokens, AVG(proxy_time) as avg_time").
-		Where("created_at > ?", since).
+		Select("provider_name as name, COUNT(*) as total, SUM(CASE WHEN status = 'success' THEN 1 ELSE 0 END) as success, COALESCE(SUM(total_tokens), 0) as total_tokens, COALESCE(SUM(cost), 0) as cost, AVG(proxy_time) as avg_time").
+		Where("created_at > ? AND status <> ?", since, "hedged").
 		Group("provider_name").
 		Order("total DESC").
-		Limit(5).
 		Scan(&providerStats).Error; err != nil {
 		slog.Error("Failed to get provider stats", "error", err)
 	}
 
-	stats.TopProviders = make([]ProviderUsageStats, 0, len(providerStats))
+	providerUsage := make([]ProviderUsageStats, 0, len(providerStats))
 	for _, ps := range providerStats {
 		successRate := float64(0)
 		if ps.Total > 0 {
 			successRate = float64(ps.Success) / float64(ps.Total) * 100
 		}
-		stats.TopProviders = append(stats.TopProviders, ProviderUsageStats{
+		providerUsage = append(providerUsage, ProviderUsageStats{
 			ProviderName:    ps.Name,
 			RequestCount:    ps.Total,
 			SuccessRate:     successRate,
 			TotalTokens:     ps.TotalTokens,
+			Cost:            ps.Cost,
 			AvgResponseTime: ps.AvgTime / float64(time.Millisecond),
 		})
 	}
+	stats.TopProviders = providerUsage[:min(len(providerUsage), 5)]
+	stats.ProviderSpend = slices.Clone(providerUsage)
+	slices.SortStableFunc(stats.ProviderSpend, func(a, b ProviderUsageStats) int {
+		return cmp.Compare(b.Cost, a.Cost)
+	})
 
 	// 计算健康提供商数量
 	providers, _ := gorm.G[models.Provider](models.DB).Find(ctx)
@@ -731,7 +804,7 @@ func GetRealtimeStats(c *gin.Context) {
 	var avgResponseTime float64
 	
 	models.DB.Model(&models.ChatLog{}).
-		Where("created_at > ?", since).
+		Where("created_at > ? AND status <> ?", since, "hedged").
 		Count(&total)
 	
 	models.DB.Model(&models.ChatLog{}).
@@ -751,11 +824,17 @@ func GetRealtimeStats(c *gin.Context) {
 	stats["requests_1h"] = total
 	stats["success_rate_1h"] = successRate
 	stats["avg_response_time_1h"] = avgResponseTime / float64(time.Millisecond)
+	stats["queue_length"] = service.GetQueueStats(c.Request.Context()).Length
 	stats["timestamp"] = time.Now().Unix()
 	
 	common.Success(c, stats)
 }
 
+// GetQueueStats 获取请求队列的长度与等待时间指标
+func GetQueueStats(c *gin.Context) {
+	common.Success(c, service.GetQueueStats(c.Request.Context()))
+}
+
 // ImportConfig 导入配置
 func ImportConfig(c *gin.Context) {
 	var config struct {
@@ -894,6 +973,11 @@ func ClearLogs(c *gin.Context) {
 		common.InternalServerError(c, "Failed to clear logs: "+result.Error.Error())
 		return
 	}
+	// 影子请求日志一并清理
+	if err := models.DB.Where("created_at < ?", cutoffTime).Delete(&models.ShadowLog{}).Error; err != nil {
+		common.InternalServerError(c, "Failed to clear shadow logs: "+err.Error())
+		return
+	}
 
 	common.Success(c, map[string]interface{}{
 		"deleted_count": result.RowsAffected,
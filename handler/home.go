@@ -12,8 +12,9 @@
 )
 
 type MetricsRes struct {
-	Reqs   int64 `json:"reqs"`
-	Tokens int64 `json:"tokens"`
+	Reqs   int64   `json:"reqs"`
+	Tokens int64   `json:"tokens"`
+	Cost   float64 `json:"cost"`
 }
 
 func Metrics(c *gin.Context) {
@@ -25,7 +26,7 @@ func Metrics(c *gin.Context) {
 
 	now := time.Now()
 	year, month, day := now.Date()
-	chain := gorm.G[models.ChatLog](models.DB).Where("created_at >= ?", time.Date(year, month, day, 0, 0, 0, 0, now.Location()).AddDate(0, 0, -days))
+	chain := gorm.G[models.ChatLog](models.DB).Where("created_at >= ? AND status <> ?", time.Date(year, month, day, 0, 0, 0, 0, now.Location()).AddDate(0, 0, -days), "hedged")
 
 	reqs, err := chain.Count(c.Request.Context(), "id")
 	if err != nil {
@@ -37,9 +38,15 @@ func Metrics(c *gin.Context) {
 		common.InternalServerError(c, "Failed to sum tokens: "+err.Error())
 		return
 	}
+	var cost sql.NullFloat64
+	if err := chain.Select("sum(cost) as cost").Scan(c.Request.Context(), &cost); err != nil {
+		common.InternalServerError(c, "Failed to sum cost: "+err.Error())
+		return
+	}
 	common.Success(c, MetricsRes{
 		Reqs:   reqs,
 		Tokens: tokens.Int64,
+		Cost:   cost.Float64,
 	})
 }
 
@@ -50,7 +57,7 @@ type Count struct {
 
 func Counts(c *gin.Context) {
 	results := make([]Count, 0)
-	if err := models.DB.Raw("SELECT name as model,COUNT(*) as calls FROM `chat_logs` WHERE `chat_logs`.`deleted_at` IS NULL  GROUP BY `name` ORDER BY `calls` DESC").Scan(&results).Error; err != nil {
+	if err := models.DB.Raw("SELECT name as model,COUNT(*) as calls FROM `chat_logs` WHERE `chat_logs`.`deleted_at` IS NULL AND `status` <> 'hedged' GROUP BY `name` ORDER BY `calls` DESC").Scan(&results).Error; err != nil {
 		common.InternalServerError(c, err.Error())
 	}
 	const topN = 5
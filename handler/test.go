@@ -56,7 +56,11 @@ func ProviderTestHandler(c *gin.Context) {
 	}
 
 	// Test connectivity by fetching models
-	client := providers.GetClient(time.Second * time.Duration(30))
+	client, err := providers.GetClientWithProxy(time.Second*time.Duration(30), providers.ProxyOf(chatModel.Config))
+	if err != nil {
+		common.BadRequest(c, "Failed to create client: "+err.Error())
+		return
+	}
 	res, err := providerInstance.Chat(c.Request.Context(), client, chatModel.Model, []byte(testBody))
 	if err != nil {
 		common.ErrorWithHttpStatus(c, http.StatusOK, 502, "Failed to connect to provider: "+err.Error())
@@ -96,9 +100,16 @@ func TestReactHandler(c *gin.Context) {
 		return
 	}
 
+	httpClient, err := providers.GetClientWithProxy(time.Second*time.Duration(30), config.Proxy)
+	if err != nil {
+		common.BadRequest(c, "Failed to create client: "+err.Error())
+		return
+	}
+
 	client := openai.NewClient(
 		option.WithBaseURL(config.BaseURL),
-		option.WithAPIKey(config.APIKey),
+		option.WithAPIKey(config.First()),
+		option.WithHTTPClient(httpClient),
 	)
 
 	agent := react.New(client, 20)
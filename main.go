@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"log/slog"
 	"net/http"
 	"os"
@@ -31,6 +32,8 @@ func main() {
 	if err := healthCheckService.Start(); err != nil {
 		slog.Error("Failed to start health check service", "error", err)
 	}
+	// 定期检查灰度关联 放量到期转正 表现变差时回滚
+	go service.RunCanaryMonitor(context.Background())
 	
 	// 设置优雅关闭
 	sigChan := make(chan os.Signal, 1)
@@ -59,6 +62,8 @@ func main() {
 
 	v1.POST("/chat/completions", authOpenAi, handler.ChatCompletionsHandler)
 	v1.POST("/messages", authAnthropic, handler.Messages)
+	v1.POST("/responses", authOpenAi, handler.Responses)
+	v1.POST("/embeddings", authOpenAi, handler.Embeddings)
 
 	api := router.Group("/api")
 	api.Use(middleware.Auth(os.Getenv("TOKEN")))
@@ -76,14 +81,24 @@ func main() {
 	api.GET("/models", handler.GetModels)
 	api.POST("/models", handler.CreateModel)
 	api.PUT("/models/:id", handler.UpdateModel)
+	api.GET("/models/:id/shadow", handler.GetModelShadowComparison)
 	api.DELETE("/models/:id", handler.DeleteModel)
 
 	// Model-provider association management
 	api.GET("/model-providers", handler.GetModelProviders)
 	api.GET("/model-providers/status", handler.GetModelProviderStatus)
+	api.GET("/model-providers/utilization", handler.GetModelProviderUtilization)
 	api.POST("/model-providers", handler.CreateModelProvider)
 	api.PUT("/model-providers/:id", handler.UpdateModelProvider)
 	api.DELETE("/model-providers/:id", handler.DeleteModelProvider)
+	api.GET("/model-providers/:id/canary-events", handler.GetModelProviderCanaryEvents)
+
+	// Routing rules
+	api.GET("/routing-rules", handler.GetRoutingRules)
+	api.POST("/routing-rules", handler.CreateRoutingRule)
+	api.PUT("/routing-rules/:id", handler.UpdateRoutingRule)
+	api.DELETE("/routing-rules/:id", handler.DeleteRoutingRule)
+	api.POST("/routing-rules/evaluate", handler.EvaluateRoutingRules)
 
 	// System status and monitoring
 	api.GET("/logs", handler.GetRequestLogs)
@@ -92,6 +107,7 @@ func main() {
 	// Dashboard and statistics
 	api.GET("/dashboard/stats", handler.GetDashboardStats)
 	api.GET("/dashboard/realtime", handler.GetRealtimeStats)
+	api.GET("/dashboard/queue", handler.GetQueueStats)
 	
 	// Provider health checks
 	api.GET("/providers/health", handler.GetAllProvidersHealth)
@@ -20,15 +20,22 @@ func Init(name string) {
 		&Model{},
 		&ModelWithProvider{},
 		&ChatLog{},
+		&ShadowLog{},
+		&CanaryEvent{},
+		&RoutingRule{},
 		&ProviderValidation{},
 		&ProviderUsageStats{},
 		&HealthCheckConfig{},
+		&SystemConfig{},
 	); err != nil {
 		panic(err)
 	}
 	
 	// 初始化默认健康检查配置
 	initHealthCheckConfig(db)
+
+	// 初始化默认系统配置
+	initSystemConfig(db)
 	
 	// 创建性能优化索引
 	createPerformanceIndexes(db)
@@ -51,6 +58,31 @@ func initHealthCheckConfig(db *gorm.DB) {
 	}
 }
 
+// initSystemConfig 初始化系统配置
+func initSystemConfig(db *gorm.DB) {
+	var config SystemConfig
+	if err := db.First(&config).Error; err == gorm.ErrRecordNotFound {
+		config = DefaultSystemConfig()
+		db.Create(&config)
+	}
+}
+
+// DefaultSystemConfig 默认系统配置
+func DefaultSystemConfig() SystemConfig {
+	return SystemConfig{
+		EnableSmartRouting:  true,
+		SuccessRateWeight:   0.7,
+		ResponseTimeWeight:  0.3,
+		DecayThresholdHours: 24,
+		MinWeight:           1,
+		QueueSize:           100,
+
+		CanaryMaxErrorRateDelta: 0.1,
+		CanaryMaxTTFTRatio:      2,
+		CanaryMinSamples:        20,
+	}
+}
+
 // createPerformanceIndexes 创建数据库性能优化索引
 func createPerformanceIndexes(db *gorm.DB) {
 	// ChatLogs表索引
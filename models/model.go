@@ -11,7 +11,8 @@ type Provider struct {
 	Name    string
 	Type    string `gorm:"index"` // 为type字段创建索引
 	Config  string
-	Console string // 控制台地址
+	Console string   // 控制台地址
+	Tags    []string `gorm:"serializer:json"` // 标签 如地域、厂商 供路由规则选择提供商
 }
 
 type AnthropicConfig struct {
@@ -22,21 +23,56 @@ type AnthropicConfig struct {
 
 type Model struct {
 	gorm.Model
-	Name     string `gorm:"index"` // 为name字段创建索引
-	Remark   string
-	MaxRetry int // 重试次数限制
-	TimeOut  int // 超时时间 单位秒
+	Name                string `gorm:"index"` // 为name字段创建索引
+	Remark              string
+	MaxRetry            int      // 重试次数限制
+	TimeOut             int      // 超时时间 单位秒
+	Strategy            string   // 负载均衡策略 为空时使用加权随机
+	Fallbacks           []string `gorm:"serializer:json"` // 提供商全部失败时依次尝试的模型名称
+	HedgeDelay          int      // 对冲延迟 单位毫秒 首个尝试超过该时间仍无首个chunk时向另一个关联发起请求 0表示不对冲
+	Sticky              bool     // 是否按会话粘性路由 同一会话固定使用同一关联以利用上游的提示词缓存
+	ShadowProviderID    uint     // 影子流量目标提供商 0表示不开启 影子请求的响应不返回给客户端
+	ShadowProviderModel string   // 影子流量目标提供商的模型名称
+	ShadowPercent       int      // 复制到影子目标的请求百分比 0-100
 }
 
 type ModelWithProvider struct {
 	gorm.Model
-	ModelID          uint   `gorm:"index:idx_model_provider"` // 复合索引的一部分
+	ModelID          uint `gorm:"index:idx_model_provider"` // 复合索引的一部分
 	ProviderModel    string
-	ProviderID       uint   `gorm:"index:idx_model_provider"` // 复合索引的一部分
-	ToolCall         *bool  // 能否接受带有工具调用的请求
-	StructuredOutput *bool  // 能否接受带有结构化输出的请求
-	Image            *bool  // 能否接受带有图片的请求(视觉)
+	ProviderID       uint  `gorm:"index:idx_model_provider"` // 复合索引的一部分
+	ToolCall         *bool // 能否接受带有工具调用的请求
+	StructuredOutput *bool // 能否接受带有结构化输出的请求
+	Image            *bool // 能否接受带有图片的请求(视觉)
 	Weight           int
+	Priority         int      // 优先级 数值越大越优先 同一优先级的关联组成一层
+	RPMLimit         int      // 每分钟请求数上限 0表示不限制
+	TPMLimit         int      // 每分钟token数上限 0表示不限制
+	MaxConcurrency   int      // 最大并发请求数 0表示不限制
+	ContextWindow    int      // 上下文窗口(输入与输出token之和) 0表示未知 不做检查
+	MaxOutputTokens  int      // 最大输出token数 0表示未知 不做检查
+	InputPrice       float64  // 输入价格 每百万token
+	OutputPrice      float64  // 输出价格 每百万token
+	CachedPrice      *float64 // 缓存命中的输入价格 每百万token 为空表示按输入价格计
+
+	Canary            bool       // 是否处于灰度 灰度期间按计划逐步放量 表现明显差于同模型其他关联时自动回滚
+	CanaryStartedAt   *time.Time // 灰度开始时间
+	CanaryPercent     int        // 灰度起始流量 按权重的百分比计 1-100
+	CanaryRampMinutes int        // 从起始流量线性升至全部权重所需的分钟数 到期后结束灰度
+}
+
+// CanaryEvent 灰度事件 开始、转正或自动回滚
+type CanaryEvent struct {
+	gorm.Model
+	ModelWithProviderID uint    `gorm:"index"`
+	Event               string  // started promoted rolled_back
+	Reason              string  // 回滚原因
+	Requests            int64   // 灰度开始以来该关联的请求数
+	ErrorRate           float64 // 灰度开始以来该关联的错误率
+	AvgTTFT             float64 // 灰度开始以来该关联成功请求的平均首字时间(毫秒)
+	PeerRequests        int64   // 同期同模型其他关联的请求数
+	PeerErrorRate       float64
+	PeerAvgTTFT         float64
 }
 
 type ChatLog struct {
@@ -49,10 +85,27 @@ type ChatLog struct {
 
 	Error          string        // if status is error, this field will be set
 	Retry          int           // 重试次数
+	Priority       int           // 本次尝试所在的优先级层
+	FallbackFrom   string        // 回退前请求的模型 为空表示未回退
 	ProxyTime      time.Duration // 代理耗时
 	FirstChunkTime time.Duration // 首个chunk耗时
 	ChunkTime      time.Duration // chunk耗时
 	Tps            float64
+	Cost           float64 // 费用 按关联的价格与token用量计算
+	Usage
+}
+
+// ShadowLog 影子请求日志 与ChatLog分开存放 不计入请求统计
+type ShadowLog struct {
+	gorm.Model
+	Name           string `gorm:"index"` // 客户端请求的模型
+	ProviderName   string
+	ProviderModel  string
+	Status         string
+	Style          string
+	Error          string
+	FirstChunkTime time.Duration // 从发出请求到首个chunk的耗时
+	ChunkTime      time.Duration
 	Usage
 }
 
@@ -70,6 +123,11 @@ type Usage struct {
 	PromptTokens     int64 `json:"prompt_tokens"`
 	CompletionTokens int64 `json:"completion_tokens"`
 	TotalTokens      int64 `json:"total_tokens"`
+	CachedTokens     int64 `json:"cached_tokens"` // 输入中命中缓存的token数 包含在PromptTokens中
+
+	// Anthropic的input_tokens不含缓存读写的token 单独记录用于计费 不计入PromptTokens
+	CacheCreationTokens int64 `json:"cache_creation_tokens"`
+	CacheReadTokens     int64 `json:"cache_read_tokens"`
 }
 
 // ProviderValidation 提供商验证状态表 - 用于智能健康检查
@@ -101,6 +159,27 @@ type ProviderUsageStats struct {
 	LastUsedAt       time.Time `gorm:"index"`      // 最后使用时间
 }
 
+// RoutingRule 路由规则 在负载均衡前匹配请求 命中的规则全部生效
+// 匹配条件均为空时匹配所有请求 多个条件需同时满足
+type RoutingRule struct {
+	gorm.Model
+	Name     string
+	Enabled  bool
+	Priority int // 数值越大越先匹配 多条规则覆盖策略时以先匹配的为准
+
+	Headers      map[string]string `gorm:"serializer:json"` // 请求头 -> 值的通配模式
+	APIKeys      []string          `gorm:"serializer:json"` // 请求使用的API Key为其中之一
+	ModelPattern string            // 模型名称的通配模式 如 claude-*
+	Stream       *bool             // 是否流式 为空表示不限
+	ToolCall     *bool             // 是否带有工具调用 为空表示不限
+	Image        *bool             // 是否带有图片 为空表示不限
+
+	IncludeTags      []string `gorm:"serializer:json"` // 只使用带有其中任一标签的提供商
+	ExcludeTags      []string `gorm:"serializer:json"` // 不使用带有其中任一标签的提供商
+	ExcludeProviders []uint   `gorm:"serializer:json"` // 不使用的提供商ID
+	Strategy         string   // 覆盖模型配置的负载均衡策略 为空表示不覆盖
+}
+
 // HealthCheckConfig 健康检查配置
 type HealthCheckConfig struct {
 	gorm.Model
@@ -109,3 +188,21 @@ type HealthCheckConfig struct {
 	MaxErrorCount   int  `gorm:"default:5"`     // 最大错误次数
 	RetryAfterHours int  `gorm:"default:1"`     // 错误后多久重试(小时)
 }
+
+// SystemConfig 系统配置 - 智能路由与请求排队参数
+// 字段不设置gorm默认值 否则首次保存时零值(如关闭智能路由)会被默认值替换 默认值见DefaultSystemConfig
+type SystemConfig struct {
+	gorm.Model
+	EnableSmartRouting  bool    `json:"enable_smart_routing"`  // 是否按近期表现调整权重
+	SuccessRateWeight   float64 `json:"success_rate_weight"`   // 成功率在有效权重中的占比
+	ResponseTimeWeight  float64 `json:"response_time_weight"`  // 响应时间在有效权重中的占比
+	DecayThresholdHours int     `json:"decay_threshold_hours"` // 统计窗口(小时) 更早的数据不再影响权重
+	MinWeight           int     `json:"min_weight"`            // 调整后的最小权重
+
+	QueueSize       int            `json:"queue_size"`                              // 所有关联均达到限额时最多排队的请求数 0表示不排队
+	QueuePriorities map[string]int `json:"queue_priorities" gorm:"serializer:json"` // API Key -> 排队优先级
+
+	CanaryMaxErrorRateDelta float64 `json:"canary_max_error_rate_delta"` // 灰度关联错误率最多高出其他关联的值 0表示不检查
+	CanaryMaxTTFTRatio      float64 `json:"canary_max_ttft_ratio"`       // 灰度关联平均首字时间最多为其他关联的倍数 0表示不检查
+	CanaryMinSamples        int     `json:"canary_min_samples"`          // 灰度关联与其他关联的请求数均达到该值后才做比较
+}
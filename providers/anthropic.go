@@ -13,11 +13,18 @@
 
 type Anthropic struct {
 	BaseURL string `json:"base_url"`
-	APIKey  string `json:"api_key"`
+	Keys
+	Outbound
+	Overrides
 	Version string `json:"version"`
 	Beta    string `json:"beta"`
 }
 
+// setAuth 设置x-api-key认证头
+func (a *Anthropic) setAuth(header http.Header, key string) {
+	header.Set("x-api-key", key)
+}
+
 // GetHost 获取Anthropic的主机地址
 func (a *Anthropic) GetHost() string {
 	return a.BaseURL
@@ -33,15 +40,18 @@ func (a *Anthropic) Chat(ctx context.Context, client *http.Client, model string,
 	if err != nil {
 		return nil, err
 	}
+	if body, err = a.applyBody(body); err != nil {
+		return nil, err
+	}
 	req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s/messages", a.BaseURL), bytes.NewReader(body))
 	if err != nil {
 		return nil, err
 	}
 	req.Header.Set("content-type", "application/json")
-	req.Header.Set("x-api-key", a.APIKey)
 	req.Header.Set("anthropic-version", a.Version)
 	req.Header.Set("anthropic-beta", a.Beta)
-	return client.Do(req)
+	a.applyHeaders(req.Header)
+	return a.do(client, req, a.setAuth)
 }
 
 type AnthropicModelsResponse struct {
@@ -64,10 +74,14 @@ func (a *Anthropic) Models(ctx context.Context) ([]Model, error) {
 		return nil, err
 	}
 	req.Header.Set("content-type", "application/json")
-	req.Header.Set("x-api-key", a.APIKey)
 	req.Header.Set("anthropic-version", a.Version)
 	req.Header.Set("anthropic-beta", a.Beta)
-	res, err := http.DefaultClient.Do(req)
+	a.applyHeaders(req.Header)
+	client, err := a.modelsClient()
+	if err != nil {
+		return nil, err
+	}
+	res, err := a.do(client, req, a.setAuth)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,159 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/tidwall/sjson"
+)
+
+// azureDefaultAPIVersion 未配置api_version时使用的GA版本
+const azureDefaultAPIVersion = "2024-10-21"
+
+// azureDeploymentsAPIVersion 列出部署所用的api-version(新版本的数据面已移除该接口)
+const azureDeploymentsAPIVersion = "2022-12-01"
+
+// Azure Azure OpenAI 提供商 ProviderModel即部署名称
+type Azure struct {
+	BaseURL string `json:"base_url"` // https://{resource}.openai.azure.com
+	Keys
+	Outbound
+	Overrides
+	APIVersion      string `json:"api_version"`
+	NativeResponses bool   `json:"responses"` // 是否开启Responses API(需要支持该接口的api_version)
+}
+
+// setAuth 设置api-key认证头
+func (a *Azure) setAuth(header http.Header, key string) {
+	header.Set("api-key", key)
+}
+
+// GetHost 获取Azure的主机地址
+func (a *Azure) GetHost() string {
+	return a.BaseURL
+}
+
+// GetTimeout 获取请求超时时间
+func (a *Azure) GetTimeout() time.Duration {
+	return 30 * time.Second
+}
+
+func (a *Azure) Chat(ctx context.Context, client *http.Client, model string, rawBody []byte) (*http.Response, error) {
+	body, err := sjson.SetBytes(rawBody, "model", model)
+	if err != nil {
+		return nil, err
+	}
+	if body, err = a.applyBody(body); err != nil {
+		return nil, err
+	}
+	endpoint := fmt.Sprintf("%s/openai/deployments/%s/chat/completions?api-version=%s", a.BaseURL, url.PathEscape(model), url.QueryEscape(a.APIVersion))
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	a.applyHeaders(req.Header)
+
+	return a.do(client, req, a.setAuth)
+}
+
+// SupportsResponses 是否直接透传Responses请求
+func (a *Azure) SupportsResponses() bool {
+	return a.NativeResponses
+}
+
+// Responses Azure的Responses接口通过请求体中的model指定部署
+func (a *Azure) Responses(ctx context.Context, client *http.Client, model string, rawBody []byte) (*http.Response, error) {
+	body, err := sjson.SetBytes(rawBody, "model", model)
+	if err != nil {
+		return nil, err
+	}
+	if body, err = a.applyBody(body); err != nil {
+		return nil, err
+	}
+	endpoint := fmt.Sprintf("%s/openai/responses?api-version=%s", a.BaseURL, url.QueryEscape(a.APIVersion))
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	a.applyHeaders(req.Header)
+
+	return a.do(client, req, a.setAuth)
+}
+
+// Embeddings 调用部署的embeddings接口
+func (a *Azure) Embeddings(ctx context.Context, client *http.Client, model string, rawBody []byte) (*http.Response, error) {
+	body, err := sjson.SetBytes(rawBody, "model", model)
+	if err != nil {
+		return nil, err
+	}
+	if body, err = a.applyBody(body); err != nil {
+		return nil, err
+	}
+	endpoint := fmt.Sprintf("%s/openai/deployments/%s/embeddings?api-version=%s", a.BaseURL, url.PathEscape(model), url.QueryEscape(a.APIVersion))
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	a.applyHeaders(req.Header)
+
+	return a.do(client, req, a.setAuth)
+}
+
+type AzureDeploymentsResponse struct {
+	Data []AzureDeployment `json:"data"`
+}
+
+type AzureDeployment struct {
+	ID        string `json:"id"`
+	Model     string `json:"model"`
+	Status    string `json:"status"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// Models 返回部署列表 部署名称作为模型ID
+func (a *Azure) Models(ctx context.Context) ([]Model, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/openai/deployments?api-version=%s", a.BaseURL, azureDeploymentsAPIVersion), nil)
+	if err != nil {
+		return nil, err
+	}
+	a.applyHeaders(req.Header)
+	client, err := a.modelsClient()
+	if err != nil {
+		return nil, err
+	}
+	res, err := a.do(client, req, a.setAuth)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status code: %d", res.StatusCode)
+	}
+	var deployments AzureDeploymentsResponse
+	if err := json.NewDecoder(res.Body).Decode(&deployments); err != nil {
+		return nil, err
+	}
+
+	var modelList ModelList
+	for _, deployment := range deployments.Data {
+		if deployment.Status != "" && deployment.Status != "succeeded" {
+			continue
+		}
+		modelList.Data = append(modelList.Data, Model{
+			ID:      deployment.ID,
+			Object:  "model",
+			Created: deployment.CreatedAt,
+			OwnedBy: deployment.Model,
+		})
+	}
+	return modelList.Data, nil
+}
@@ -0,0 +1,49 @@
+package providers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestAzureChat(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/openai/deployments/gpt-4o-prod/chat/completions" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if got := r.URL.Query().Get("api-version"); got != azureDefaultAPIVersion {
+			t.Errorf("unexpected api-version %q", got)
+		}
+		if r.Header.Get("api-key") != "test-key" {
+			t.Errorf("missing api-key header")
+		}
+		if r.Header.Get("Authorization") != "" {
+			t.Errorf("unexpected Authorization header")
+		}
+		body, _ := io.ReadAll(r.Body)
+		if got := gjson.GetBytes(body, "model").String(); got != "gpt-4o-prod" {
+			t.Errorf("unexpected model %s", got)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"choices":[{"message":{"role":"assistant","content":"hi"}}]}`)
+	}))
+	defer server.Close()
+
+	// 未配置api_version时使用默认版本
+	provider, err := New("azure", `{"base_url":"`+server.URL+`","api_key":"test-key"}`)
+	if err != nil {
+		t.Fatalf("new provider: %v", err)
+	}
+	res, err := provider.Chat(context.Background(), server.Client(), "gpt-4o-prod", []byte(`{"model":"gpt-4o","messages":[]}`))
+	if err != nil {
+		t.Fatalf("chat: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("unexpected status %d", res.StatusCode)
+	}
+}
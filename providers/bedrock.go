@@ -0,0 +1,207 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+const (
+	bedrockAnthropicVersion = "bedrock-2023-05-31"
+	bedrockService          = "bedrock"
+)
+
+// Bedrock AWS Bedrock 提供商 使用静态凭证进行SigV4签名 接受Anthropic风格的请求体
+type Bedrock struct {
+	BaseURL         string `json:"base_url"` // 可选 默认 https://bedrock-runtime.{region}.amazonaws.com
+	Region          string `json:"region"`
+	AccessKeyID     string `json:"access_key_id"`
+	SecretAccessKey string `json:"secret_access_key"`
+	SessionToken    string `json:"session_token"`
+	Outbound
+	Overrides
+}
+
+// GetHost 获取Bedrock的主机地址
+func (b *Bedrock) GetHost() string {
+	return b.runtimeURL()
+}
+
+// GetTimeout 获取请求超时时间
+func (b *Bedrock) GetTimeout() time.Duration {
+	return 30 * time.Second
+}
+
+func (b *Bedrock) runtimeURL() string {
+	if b.BaseURL != "" {
+		return b.BaseURL
+	}
+	return fmt.Sprintf("https://bedrock-runtime.%s.amazonaws.com", b.Region)
+}
+
+func (b *Bedrock) controlURL() string {
+	if b.BaseURL != "" {
+		return b.BaseURL
+	}
+	return fmt.Sprintf("https://bedrock.%s.amazonaws.com", b.Region)
+}
+
+func (b *Bedrock) credentials() AWSCredentials {
+	return AWSCredentials{
+		AccessKeyID:     b.AccessKeyID,
+		SecretAccessKey: b.SecretAccessKey,
+		SessionToken:    b.SessionToken,
+	}
+}
+
+// Chat 调用InvokeModel/InvokeModelWithResponseStream 流式响应转换为Anthropic SSE
+func (b *Bedrock) Chat(ctx context.Context, client *http.Client, model string, rawBody []byte) (*http.Response, error) {
+	stream := gjson.GetBytes(rawBody, "stream").Bool()
+	// Bedrock通过路径指定模型与是否流式 请求体中不允许出现model/stream
+	body, err := sjson.DeleteBytes(rawBody, "model")
+	if err != nil {
+		return nil, err
+	}
+	if body, err = sjson.DeleteBytes(body, "stream"); err != nil {
+		return nil, err
+	}
+	if !gjson.GetBytes(body, "anthropic_version").Exists() {
+		if body, err = sjson.SetBytes(body, "anthropic_version", bedrockAnthropicVersion); err != nil {
+			return nil, err
+		}
+	}
+
+	if body, err = b.applyBody(body); err != nil {
+		return nil, err
+	}
+
+	action := "invoke"
+	accept := "application/json"
+	if stream {
+		action = "invoke-with-response-stream"
+		accept = "application/vnd.amazon.eventstream"
+	}
+	endpoint, err := url.Parse(fmt.Sprintf("%s/model/%s/%s", b.runtimeURL(), awsURIEncode(model), action))
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", accept)
+	b.applyHeaders(req.Header)
+	signV4(req, body, b.credentials(), b.Region, bedrockService, time.Now())
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	// 非200响应与非流式响应(已是Anthropic格式)保持原样
+	if res.StatusCode != http.StatusOK || !stream {
+		return res, nil
+	}
+	res.Header.Set("Content-Type", "text/event-stream")
+	res.Header.Del("Content-Length")
+	res.ContentLength = -1
+	res.Body = convertStream(res.Body, bedrockEventStreamToSSE)
+	return res, nil
+}
+
+// bedrockEventStreamToSSE 将Bedrock的event-stream帧解码为Anthropic SSE事件
+func bedrockEventStreamToSSE(r io.Reader, w io.Writer) error {
+	for {
+		message, err := readEventStreamMessage(r)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		switch message.headers[":message-type"] {
+		case "event":
+			if message.headers[":event-type"] != "chunk" {
+				continue
+			}
+			encoded := gjson.GetBytes(message.payload, "bytes").String()
+			data, err := base64.StdEncoding.DecodeString(encoded)
+			if err != nil {
+				return err
+			}
+			if err := writeSSE(w, gjson.GetBytes(data, "type").String(), data); err != nil {
+				return err
+			}
+		case "exception":
+			// 流式过程中的异常 转为Anthropic的error事件后结束
+			data, err := json.Marshal(map[string]any{
+				"type": "error",
+				"error": map[string]any{
+					"type":    message.headers[":exception-type"],
+					"message": gjson.GetBytes(message.payload, "message").String(),
+				},
+			})
+			if err != nil {
+				return err
+			}
+			return writeSSE(w, "error", data)
+		}
+	}
+}
+
+type BedrockModelsResponse struct {
+	ModelSummaries []BedrockModelSummary `json:"modelSummaries"`
+}
+
+type BedrockModelSummary struct {
+	ModelID      string `json:"modelId"`
+	ModelName    string `json:"modelName"`
+	ProviderName string `json:"providerName"`
+}
+
+// Models 通过ListFoundationModels获取Anthropic模型列表
+func (b *Bedrock) Models(ctx context.Context) ([]Model, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/foundation-models?byProvider=anthropic&byOutputModality=TEXT", b.controlURL()), nil)
+	if err != nil {
+		return nil, err
+	}
+	b.applyHeaders(req.Header)
+	signV4(req, nil, b.credentials(), b.Region, bedrockService, time.Now())
+	client, err := b.modelsClient()
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status code: %d", res.StatusCode)
+	}
+	var bedrockModels BedrockModelsResponse
+	if err := json.NewDecoder(res.Body).Decode(&bedrockModels); err != nil {
+		return nil, err
+	}
+
+	var modelList ModelList
+	for _, model := range bedrockModels.ModelSummaries {
+		modelList.Data = append(modelList.Data, Model{
+			ID:      model.ModelID,
+			Object:  "model",
+			OwnedBy: model.ProviderName,
+		})
+	}
+	return modelList.Data, nil
+}
@@ -0,0 +1,135 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+// AWS SigV4 官方测试用例 get-vanilla
+func TestSignV4Vanilla(t *testing.T) {
+	req, _ := http.NewRequest("GET", "https://example.amazonaws.com/", nil)
+	now, _ := time.Parse(sigV4TimeFormat, "20150830T123600Z")
+	signV4(req, nil, AWSCredentials{
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}, "us-east-1", "service", now)
+
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Errorf("unexpected authorization\n got: %s\nwant: %s", got, want)
+	}
+}
+
+// encodeEventStreamChunk 构造一条Bedrock chunk事件帧
+func encodeEventStreamChunk(payload string) []byte {
+	var headers bytes.Buffer
+	for _, header := range [][2]string{{":message-type", "event"}, {":event-type", "chunk"}} {
+		headers.WriteByte(byte(len(header[0])))
+		headers.WriteString(header[0])
+		headers.WriteByte(7)
+		binary.Write(&headers, binary.BigEndian, uint16(len(header[1])))
+		headers.WriteString(header[1])
+	}
+	body := []byte(`{"bytes":"` + base64.StdEncoding.EncodeToString([]byte(payload)) + `"}`)
+
+	total := eventStreamPreludeLen + headers.Len() + len(body) + 4
+	var msg bytes.Buffer
+	binary.Write(&msg, binary.BigEndian, uint32(total))
+	binary.Write(&msg, binary.BigEndian, uint32(headers.Len()))
+	binary.Write(&msg, binary.BigEndian, crc32.ChecksumIEEE(msg.Bytes()))
+	msg.Write(headers.Bytes())
+	msg.Write(body)
+	binary.Write(&msg, binary.BigEndian, crc32.ChecksumIEEE(msg.Bytes()))
+	return msg.Bytes()
+}
+
+func TestBedrockChatStream(t *testing.T) {
+	const secret = "test-secret"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.EscapedPath() != "/model/anthropic.claude-v2%3A1/invoke-with-response-stream" {
+			t.Errorf("unexpected path %s", r.URL.EscapedPath())
+		}
+		body, _ := io.ReadAll(r.Body)
+		if gjson.GetBytes(body, "model").Exists() || gjson.GetBytes(body, "stream").Exists() {
+			t.Errorf("model/stream should be removed from body: %s", body)
+		}
+		if gjson.GetBytes(body, "anthropic_version").String() != bedrockAnthropicVersion {
+			t.Errorf("missing anthropic_version: %s", body)
+		}
+
+		// 按SignedHeaders重建请求 校验签名
+		auth := r.Header.Get("Authorization")
+		signed := strings.TrimSuffix(strings.Split(strings.Split(auth, "SignedHeaders=")[1], ",")[0], ",")
+		verify, _ := http.NewRequest(r.Method, "http://"+r.Host+r.URL.RequestURI(), nil)
+		for _, name := range strings.Split(signed, ";") {
+			if name != "host" {
+				verify.Header.Set(name, r.Header.Get(name))
+			}
+		}
+		now, _ := time.Parse(sigV4TimeFormat, r.Header.Get("X-Amz-Date"))
+		_, signature := sigV4Signature(verify, body, secret, "us-west-2", bedrockService, now)
+		if !strings.HasSuffix(auth, "Signature="+signature) {
+			t.Errorf("signature mismatch: %s", auth)
+		}
+		if !strings.Contains(auth, "Credential=AKID/") || r.Header.Get("X-Amz-Security-Token") != "token" {
+			t.Errorf("unexpected credentials %s", auth)
+		}
+
+		w.Header().Set("Content-Type", "application/vnd.amazon.eventstream")
+		w.Write(encodeEventStreamChunk(`{"type":"message_start","message":{"id":"msg_1","usage":{"input_tokens":5}}}`))
+		w.Write(encodeEventStreamChunk(`{"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":3}}`))
+		w.Write(encodeEventStreamChunk(`{"type":"message_stop"}`))
+	}))
+	defer server.Close()
+
+	bedrock := &Bedrock{
+		BaseURL:         server.URL,
+		Region:          "us-west-2",
+		AccessKeyID:     "AKID",
+		SecretAccessKey: secret,
+		SessionToken:    "token",
+	}
+	res, err := bedrock.Chat(context.Background(), server.Client(), "anthropic.claude-v2:1", []byte(`{"model":"claude","stream":true,"max_tokens":10,"messages":[{"role":"user","content":"hi"}]}`))
+	if err != nil {
+		t.Fatalf("chat: %v", err)
+	}
+	defer res.Body.Close()
+
+	events := make([]string, 0)
+	if err := scanSSE(res.Body, func(event sseEvent) bool {
+		if event.event != gjson.Get(event.data, "type").String() {
+			t.Errorf("event name %s does not match payload %s", event.event, event.data)
+		}
+		events = append(events, event.event)
+		return true
+	}); err != nil {
+		t.Fatalf("read stream: %v", err)
+	}
+	if strings.Join(events, ",") != "message_start,message_delta,message_stop" {
+		t.Errorf("unexpected events %v", events)
+	}
+}
+
+func TestEventStreamMalformedHeadersLength(t *testing.T) {
+	// prelude校验和正确 但headers长度远超消息总长度
+	frame := make([]byte, eventStreamPreludeLen+4)
+	binary.BigEndian.PutUint32(frame[0:4], uint32(len(frame)))
+	binary.BigEndian.PutUint32(frame[4:8], 0xFFFFFFFF)
+	binary.BigEndian.PutUint32(frame[8:12], crc32.ChecksumIEEE(frame[0:8]))
+	binary.BigEndian.PutUint32(frame[12:16], crc32.ChecksumIEEE(frame[0:12]))
+
+	if _, err := readEventStreamMessage(bytes.NewReader(frame)); err == nil {
+		t.Error("expected error for malformed headers length")
+	}
+}
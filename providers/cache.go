@@ -2,20 +2,30 @@
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 	"net"
 	"net/http"
+	"net/url"
 	"sync"
 	"time"
+
+	"github.com/tidwall/gjson"
 )
 
+// clientKey 同一超时与代理组合共享一个客户端
+type clientKey struct {
+	timeout time.Duration
+	proxy   string
+}
+
 type clientCache struct {
 	mu      sync.RWMutex
-	clients map[time.Duration]*http.Client
+	clients map[clientKey]*http.Client
 }
 
 var cache = &clientCache{
-	clients: make(map[time.Duration]*http.Client),
+	clients: make(map[clientKey]*http.Client),
 }
 
 var dialer = &net.Dialer{
@@ -23,27 +33,85 @@ type clientCache struct {
 	KeepAlive: 30 * time.Second,
 }
 
+// modelsTimeout 获取模型列表等管理请求的响应头超时时间
+const modelsTimeout = 30 * time.Second
+
+// ProxyDirect 代理配置为direct时不使用任何代理(包括环境变量)
+const ProxyDirect = "direct"
+
+// Outbound 提供商的出站网络配置 嵌入各提供商配置中
+type Outbound struct {
+	Proxy string `json:"proxy"` // 为空时使用环境变量 direct为直连 支持http/https/socks5/socks5h
+}
+
+// modelsClient 获取模型列表所用的客户端 与Chat使用同一代理
+func (o *Outbound) modelsClient() (*http.Client, error) {
+	return GetClientWithProxy(modelsTimeout, o.Proxy)
+}
+
+// ProxyOf 读取提供商配置中的代理地址
+func ProxyOf(providerConfig string) string {
+	return gjson.Get(providerConfig, "proxy").String()
+}
+
+// proxyFunc 根据代理配置生成Transport.Proxy
+func proxyFunc(proxy string) (func(*http.Request) (*url.URL, error), error) {
+	switch proxy {
+	case "":
+		return http.ProxyFromEnvironment, nil
+	case ProxyDirect:
+		return nil, nil
+	}
+	proxyURL, err := url.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy %q: %w", proxy, err)
+	}
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q", proxyURL.Scheme)
+	}
+	if proxyURL.Host == "" {
+		return nil, fmt.Errorf("invalid proxy %q: missing host", proxy)
+	}
+	return http.ProxyURL(proxyURL), nil
+}
+
 // GetClient returns an http.Client with the specified responseHeaderTimeout.
 // If a client with the same timeout already exists, it returns the cached one.
 // Otherwise, it creates a new client and caches it.
+// The client uses the proxy from the environment.
 func GetClient(responseHeaderTimeout time.Duration) *http.Client {
+	client, _ := GetClientWithProxy(responseHeaderTimeout, "")
+	return client
+}
+
+// GetClientWithProxy 获取使用指定代理的客户端 按超时与代理缓存
+// 每个代理拥有独立的Transport 连接不会在不同代理之间复用
+func GetClientWithProxy(responseHeaderTimeout time.Duration, proxy string) (*http.Client, error) {
+	key := clientKey{timeout: responseHeaderTimeout, proxy: proxy}
 	cache.mu.RLock()
-	if client, exists := cache.clients[responseHeaderTimeout]; exists {
+	if client, exists := cache.clients[key]; exists {
 		cache.mu.RUnlock()
-		return client
+		return client, nil
 	}
 	cache.mu.RUnlock()
 
+	proxyFn, err := proxyFunc(proxy)
+	if err != nil {
+		return nil, err
+	}
+
 	cache.mu.Lock()
 	defer cache.mu.Unlock()
 
 	// Double-check after acquiring write lock
-	if client, exists := cache.clients[responseHeaderTimeout]; exists {
-		return client
+	if client, exists := cache.clients[key]; exists {
+		return client, nil
 	}
 
 	transport := &http.Transport{
-		Proxy:                 http.ProxyFromEnvironment,
+		Proxy:                 proxyFn,
 		DialContext:           dialer.DialContext,
 		ForceAttemptHTTP2:     true,
 		MaxIdleConns:          100,
@@ -58,8 +126,8 @@ func GetClient(responseHeaderTimeout time.Duration) *http.Client {
 		Timeout:   0, // No overall timeout, let ResponseHeaderTimeout control header timing
 	}
 
-	cache.clients[responseHeaderTimeout] = client
-	return client
+	cache.clients[key] = client
+	return client, nil
 }
 
 // GetPooledClientForProvider 为Provider获取带连接池的HTTP客户端
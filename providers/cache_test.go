@@ -0,0 +1,45 @@
+package providers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestGetClientWithProxy(t *testing.T) {
+	// 充当HTTP代理 记录被代理的目标地址
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		io.WriteString(w, `{"data":[{"id":"gpt-4o"}]}`)
+	}))
+	defer proxy.Close()
+
+	client, err := GetClientWithProxy(time.Second, proxy.URL)
+	if err != nil {
+		t.Fatalf("get client: %v", err)
+	}
+	if other, _ := GetClientWithProxy(time.Second, ProxyDirect); other == client {
+		t.Error("clients with different proxies should not be shared")
+	}
+	if again, _ := GetClientWithProxy(time.Second, proxy.URL); again != client {
+		t.Error("client should be cached per proxy")
+	}
+
+	openai := &OpenAI{BaseURL: "http://upstream.invalid/v1", Keys: Keys{APIKey: "test-key"}, Outbound: Outbound{Proxy: proxy.URL}}
+	models, err := openai.Models(t.Context())
+	if err != nil {
+		t.Fatalf("models: %v", err)
+	}
+	if len(models) != 1 || proxied != "http://upstream.invalid/v1/models" {
+		t.Errorf("models not fetched through proxy: %v %s", models, proxied)
+	}
+
+	for _, invalid := range []string{"ftp://proxy:21", "socks5://", "://bad"} {
+		if _, err := New("openai", `{"base_url":"http://localhost","api_key":"k","proxy":"`+invalid+`"}`); err == nil {
+			t.Errorf("expected error for proxy %q", invalid)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package providers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+const (
+	StyleOpenAI     = "openai"
+	StyleAnthropic  = "anthropic"
+	StyleResponses  = "responses"
+	StyleEmbeddings = "embeddings"
+)
+
+const (
+	initConvertBufferSize = 1024 * 8         // 8KB
+	maxConvertBufferSize  = 1024 * 1024 * 15 // 15MB
+)
+
+// ErrInvalidRequest 客户端请求体无法转换为上游格式 属于客户端错误 不应重试或计入提供商健康状态
+var ErrInvalidRequest = errors.New("invalid request")
+
+// nativeStyles 各提供商类型原生接受的请求风格
+var nativeStyles = map[string]string{
+	"openai":    StyleOpenAI,
+	"anthropic": StyleAnthropic,
+	"azure":     StyleOpenAI,
+	"bedrock":   StyleAnthropic,
+	// Gemini在Chat内部完成与generateContent之间的转换 对外表现为OpenAI风格
+	"gemini": StyleOpenAI,
+}
+
+// converter 请求风格之间的协议转换
+type converter struct {
+	// request 将客户端风格的请求体转换为上游风格
+	request func(rawBody []byte) ([]byte, error)
+	// response 将上游的非流式响应体转换回客户端风格
+	response func(body []byte) ([]byte, error)
+	// stream 将上游的SSE流转换回客户端风格
+	stream func(r io.Reader, w io.Writer) error
+}
+
+// converters 客户端风格 -> 上游风格 -> 转换器
+var converters = map[string]map[string]converter{}
+
+func registerConverter(from, to string, conv converter) {
+	if converters[from] == nil {
+		converters[from] = make(map[string]converter)
+	}
+	converters[from][to] = conv
+}
+
+// NativeStyle 返回提供商类型原生接受的请求风格
+func NativeStyle(Type string) string {
+	return nativeStyles[Type]
+}
+
+// Supports 判断提供商类型能否(直接或经协议转换)服务指定风格的请求
+func Supports(Type, style string) bool {
+	if style == StyleEmbeddings {
+		return embeddingsTypes[Type]
+	}
+	native, ok := nativeStyles[Type]
+	if !ok {
+		return false
+	}
+	if native == style {
+		return true
+	}
+	return len(converterChain(style, native)) != 0
+}
+
+// converterChain 查找style到native的转换链 没有直接转换时经由OpenAI风格中转
+func converterChain(style, native string) []converter {
+	if conv, ok := converters[style][native]; ok {
+		return []converter{conv}
+	}
+	first, ok := converters[style][StyleOpenAI]
+	if !ok {
+		return nil
+	}
+	second, ok := converters[StyleOpenAI][native]
+	if !ok {
+		return nil
+	}
+	return []converter{first, second}
+}
+
+// NewWithStyle 创建接受style风格请求体并返回style风格响应的Provider
+// 当提供商类型的原生风格与style不一致时 自动套上协议转换层
+func NewWithStyle(style, Type, providerConfig string) (Provider, error) {
+	provider, err := New(Type, providerConfig)
+	if err != nil {
+		return nil, err
+	}
+	if style == StyleEmbeddings {
+		embeddings, ok := nativeEmbeddings(provider)
+		if !ok {
+			return nil, fmt.Errorf("provider type %s can not serve %s requests", Type, style)
+		}
+		return embeddings, nil
+	}
+	// 原生支持Responses API的上游直接透传
+	if style == StyleResponses {
+		if native, ok := nativeResponses(provider); ok {
+			return native, nil
+		}
+	}
+	native := NativeStyle(Type)
+	if native == style {
+		return provider, nil
+	}
+	chain := converterChain(style, native)
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("provider type %s can not serve %s style requests", Type, style)
+	}
+	// 由内向外套转换层 最外层接受style风格
+	for i := len(chain) - 1; i >= 0; i-- {
+		provider = &convertedProvider{provider: provider, conv: chain[i]}
+	}
+	return provider, nil
+}
+
+// convertedProvider 在Provider外层做请求/响应的协议转换
+type convertedProvider struct {
+	provider Provider
+	conv     converter
+}
+
+func (p *convertedProvider) Chat(ctx context.Context, client *http.Client, model string, rawBody []byte) (*http.Response, error) {
+	body, err := p.conv.request(rawBody)
+	if err != nil {
+		return nil, fmt.Errorf("%w: convert request error: %v", ErrInvalidRequest, err)
+	}
+	res, err := p.provider.Chat(ctx, client, model, body)
+	if err != nil {
+		return nil, err
+	}
+	// 非200响应保持原样 由调用方记录错误
+	if res.StatusCode != http.StatusOK {
+		return res, nil
+	}
+	res.Header.Del("Content-Length")
+	res.ContentLength = -1
+	if gjson.GetBytes(rawBody, "stream").Bool() {
+		res.Body = convertStream(res.Body, p.conv.stream)
+		return res, nil
+	}
+	data, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	converted, err := p.conv.response(data)
+	if err != nil {
+		return nil, fmt.Errorf("convert response error: %w", err)
+	}
+	res.Body = io.NopCloser(bytes.NewReader(converted))
+	return res, nil
+}
+
+func (p *convertedProvider) Models(ctx context.Context) ([]Model, error) {
+	return p.provider.Models(ctx)
+}
+
+// convertStream 在独立协程中边读边转换上游的流式响应
+func convertStream(body io.ReadCloser, convert func(r io.Reader, w io.Writer) error) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		defer body.Close()
+		pw.CloseWithError(convert(body, pw))
+	}()
+	return &convertedBody{PipeReader: pr, upstream: body}
+}
+
+type convertedBody struct {
+	*io.PipeReader
+	upstream io.ReadCloser
+}
+
+func (b *convertedBody) Close() error {
+	b.PipeReader.Close()
+	return b.upstream.Close()
+}
+
+// sseEvent 一个SSE事件
+type sseEvent struct {
+	event string
+	data  string
+}
+
+// scanSSE 逐个读取SSE事件 yield返回false时停止
+func scanSSE(r io.Reader, yield func(sseEvent) bool) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, initConvertBufferSize), maxConvertBufferSize)
+	var current sseEvent
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if current.data != "" || current.event != "" {
+				if !yield(current) {
+					return nil
+				}
+			}
+			current = sseEvent{}
+		case strings.HasPrefix(line, "event:"):
+			current.event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data := strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " ")
+			if current.data != "" {
+				current.data += "\n"
+			}
+			current.data += data
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if current.data != "" || current.event != "" {
+		yield(current)
+	}
+	return nil
+}
+
+// writeSSE 写出一个SSE事件 event为空时只写data
+func writeSSE(w io.Writer, event string, data []byte) error {
+	var buf bytes.Buffer
+	if event != "" {
+		buf.WriteString("event: ")
+		buf.WriteString(event)
+		buf.WriteByte('\n')
+	}
+	buf.WriteString("data: ")
+	buf.Write(data)
+	buf.WriteString("\n\n")
+	_, err := w.Write(buf.Bytes())
+	return err
+}
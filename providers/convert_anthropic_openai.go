@@ -0,0 +1,419 @@
+package providers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// Anthropic Messages 客户端 -> OpenAI Chat Completions 上游
+func init() {
+	registerConverter(StyleAnthropic, StyleOpenAI, converter{
+		request:  anthropicToOpenAIRequest,
+		response: openAIToAnthropicResponse,
+		stream:   openAIToAnthropicStream,
+	})
+}
+
+func anthropicToOpenAIRequest(rawBody []byte) ([]byte, error) {
+	req := gjson.ParseBytes(rawBody)
+	if !req.IsObject() {
+		return nil, errors.New("invalid anthropic request body")
+	}
+
+	messages := make([]map[string]any, 0)
+	if system := anthropicTextOf(req.Get("system")); system != "" {
+		messages = append(messages, map[string]any{"role": "system", "content": system})
+	}
+	for _, message := range req.Get("messages").Array() {
+		messages = append(messages, anthropicMessageToOpenAI(message)...)
+	}
+
+	out := map[string]any{
+		"model":    req.Get("model").String(),
+		"messages": messages,
+	}
+	if v := req.Get("max_tokens"); v.Exists() {
+		out["max_tokens"] = v.Int()
+	}
+	if v := req.Get("temperature"); v.Exists() {
+		out["temperature"] = v.Float()
+	}
+	if v := req.Get("top_p"); v.Exists() {
+		out["top_p"] = v.Float()
+	}
+	if v := req.Get("stop_sequences"); v.Exists() && len(v.Array()) != 0 {
+		stops := make([]string, 0)
+		for _, stop := range v.Array() {
+			stops = append(stops, stop.String())
+		}
+		out["stop"] = stops
+	}
+	if v := req.Get("metadata.user_id"); v.Exists() {
+		out["user"] = v.String()
+	}
+	if req.Get("stream").Bool() {
+		out["stream"] = true
+		// 需要usage统计才能在message_delta中回填token用量
+		out["stream_options"] = map[string]any{"include_usage": true}
+	}
+
+	if tools := req.Get("tools").Array(); len(tools) != 0 {
+		openAITools := make([]map[string]any, 0, len(tools))
+		for _, tool := range tools {
+			function := map[string]any{"name": tool.Get("name").String()}
+			if desc := tool.Get("description"); desc.Exists() {
+				function["description"] = desc.String()
+			}
+			if schema := tool.Get("input_schema"); schema.Exists() {
+				function["parameters"] = json.RawMessage(schema.Raw)
+			} else {
+				function["parameters"] = map[string]any{"type": "object"}
+			}
+			openAITools = append(openAITools, map[string]any{"type": "function", "function": function})
+		}
+		out["tools"] = openAITools
+	}
+	if choice := req.Get("tool_choice"); choice.Exists() {
+		switch choice.Get("type").String() {
+		case "auto":
+			out["tool_choice"] = "auto"
+		case "any":
+			out["tool_choice"] = "required"
+		case "none":
+			out["tool_choice"] = "none"
+		case "tool":
+			out["tool_choice"] = map[string]any{
+				"type":     "function",
+				"function": map[string]any{"name": choice.Get("name").String()},
+			}
+		}
+		if choice.Get("disable_parallel_tool_use").Bool() {
+			out["parallel_tool_calls"] = false
+		}
+	}
+
+	return json.Marshal(out)
+}
+
+// anthropicMessageToOpenAI 一条Anthropic消息可能拆分为多条OpenAI消息(tool_result需要单独的tool消息)
+func anthropicMessageToOpenAI(message gjson.Result) []map[string]any {
+	role := message.Get("role").String()
+	content := message.Get("content")
+	if content.Type == gjson.String {
+		return []map[string]any{{"role": role, "content": content.String()}}
+	}
+
+	res := make([]map[string]any, 0)
+	parts := make([]map[string]any, 0)
+	toolCalls := make([]map[string]any, 0)
+	var text strings.Builder
+	for _, block := range content.Array() {
+		switch block.Get("type").String() {
+		case "text":
+			parts = append(parts, map[string]any{"type": "text", "text": block.Get("text").String()})
+			text.WriteString(block.Get("text").String())
+		case "image":
+			url := anthropicImageURL(block.Get("source"))
+			if url == "" {
+				continue
+			}
+			parts = append(parts, map[string]any{"type": "image_url", "image_url": map[string]any{"url": url}})
+		case "tool_use":
+			input := block.Get("input").Raw
+			if input == "" {
+				input = "{}"
+			}
+			toolCalls = append(toolCalls, map[string]any{
+				"id":   block.Get("id").String(),
+				"type": "function",
+				"function": map[string]any{
+					"name":      block.Get("name").String(),
+					"arguments": input,
+				},
+			})
+		case "tool_result":
+			res = append(res, map[string]any{
+				"role":         "tool",
+				"tool_call_id": block.Get("tool_use_id").String(),
+				"content":      anthropicTextOf(block.Get("content")),
+			})
+		}
+	}
+
+	if role == "assistant" {
+		msg := map[string]any{"role": "assistant"}
+		if text.Len() != 0 {
+			msg["content"] = text.String()
+		} else {
+			msg["content"] = nil
+		}
+		if len(toolCalls) != 0 {
+			msg["tool_calls"] = toolCalls
+		}
+		return append(res, msg)
+	}
+	if len(parts) != 0 {
+		res = append(res, map[string]any{"role": role, "content": parts})
+	}
+	return res
+}
+
+// anthropicTextOf 提取字符串或内容块数组中的文本
+func anthropicTextOf(content gjson.Result) string {
+	if content.Type == gjson.String {
+		return content.String()
+	}
+	texts := make([]string, 0)
+	for _, block := range content.Array() {
+		if block.Get("type").String() == "text" {
+			texts = append(texts, block.Get("text").String())
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+func anthropicImageURL(source gjson.Result) string {
+	switch source.Get("type").String() {
+	case "base64":
+		return fmt.Sprintf("data:%s;base64,%s", source.Get("media_type").String(), source.Get("data").String())
+	case "url":
+		return source.Get("url").String()
+	}
+	return ""
+}
+
+// openAIStopReason OpenAI finish_reason -> Anthropic stop_reason
+func openAIStopReason(finishReason string) string {
+	switch finishReason {
+	case "length":
+		return "max_tokens"
+	case "tool_calls", "function_call":
+		return "tool_use"
+	case "content_filter":
+		return "refusal"
+	default:
+		return "end_turn"
+	}
+}
+
+type anthropicUsage struct {
+	InputTokens          int64 `json:"input_tokens"`
+	OutputTokens         int64 `json:"output_tokens"`
+	CacheReadInputTokens int64 `json:"cache_read_input_tokens,omitempty"`
+}
+
+func openAIUsageToAnthropic(usage gjson.Result) anthropicUsage {
+	return anthropicUsage{
+		InputTokens:          usage.Get("prompt_tokens").Int(),
+		OutputTokens:         usage.Get("completion_tokens").Int(),
+		CacheReadInputTokens: usage.Get("prompt_tokens_details.cached_tokens").Int(),
+	}
+}
+
+func openAIToAnthropicResponse(body []byte) ([]byte, error) {
+	res := gjson.ParseBytes(body)
+	if !res.IsObject() {
+		return nil, errors.New("invalid openai response body")
+	}
+	choice := res.Get("choices.0")
+	message := choice.Get("message")
+
+	content := make([]map[string]any, 0)
+	if text := message.Get("content").String(); text != "" {
+		content = append(content, map[string]any{"type": "text", "text": text})
+	}
+	for _, call := range message.Get("tool_calls").Array() {
+		args := call.Get("function.arguments").String()
+		if !gjson.Valid(args) || args == "" {
+			args = "{}"
+		}
+		content = append(content, map[string]any{
+			"type":  "tool_use",
+			"id":    call.Get("id").String(),
+			"name":  call.Get("function.name").String(),
+			"input": json.RawMessage(args),
+		})
+	}
+
+	return json.Marshal(map[string]any{
+		"id":            res.Get("id").String(),
+		"type":          "message",
+		"role":          "assistant",
+		"model":         res.Get("model").String(),
+		"content":       content,
+		"stop_reason":   openAIStopReason(choice.Get("finish_reason").String()),
+		"stop_sequence": nil,
+		"usage":         openAIUsageToAnthropic(res.Get("usage")),
+	})
+}
+
+// openAIStreamState OpenAI流 -> Anthropic流 的转换状态
+type openAIStreamState struct {
+	w          io.Writer
+	started    bool
+	blockIndex int
+	blockType  string // 当前打开的内容块类型 为空表示没有打开的块
+	toolIndex  int64  // 当前tool_use块对应的OpenAI tool_calls下标
+	stopReason string
+	usage      anthropicUsage
+}
+
+func (s *openAIStreamState) emit(event string, data any) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return writeSSE(s.w, event, raw)
+}
+
+func (s *openAIStreamState) start(chunk gjson.Result) error {
+	if s.started {
+		return nil
+	}
+	s.started = true
+	return s.emit("message_start", map[string]any{
+		"type": "message_start",
+		"message": map[string]any{
+			"id":            chunk.Get("id").String(),
+			"type":          "message",
+			"role":          "assistant",
+			"model":         chunk.Get("model").String(),
+			"content":       []any{},
+			"stop_reason":   nil,
+			"stop_sequence": nil,
+			"usage":         anthropicUsage{},
+		},
+	})
+}
+
+func (s *openAIStreamState) closeBlock() error {
+	if s.blockType == "" {
+		return nil
+	}
+	s.blockType = ""
+	err := s.emit("content_block_stop", map[string]any{"type": "content_block_stop", "index": s.blockIndex})
+	s.blockIndex++
+	return err
+}
+
+func (s *openAIStreamState) openBlock(blockType string, block map[string]any) error {
+	if err := s.closeBlock(); err != nil {
+		return err
+	}
+	s.blockType = blockType
+	return s.emit("content_block_start", map[string]any{
+		"type":          "content_block_start",
+		"index":         s.blockIndex,
+		"content_block": block,
+	})
+}
+
+func (s *openAIStreamState) handle(chunk gjson.Result) error {
+	if err := s.start(chunk); err != nil {
+		return err
+	}
+	if usage := chunk.Get("usage"); usage.Exists() && usage.Type != gjson.Null {
+		s.usage = openAIUsageToAnthropic(usage)
+	}
+	choice := chunk.Get("choices.0")
+	if !choice.Exists() {
+		return nil
+	}
+	delta := choice.Get("delta")
+	if text := delta.Get("content").String(); text != "" {
+		if s.blockType != "text" {
+			if err := s.openBlock("text", map[string]any{"type": "text", "text": ""}); err != nil {
+				return err
+			}
+		}
+		if err := s.emit("content_block_delta", map[string]any{
+			"type":  "content_block_delta",
+			"index": s.blockIndex,
+			"delta": map[string]any{"type": "text_delta", "text": text},
+		}); err != nil {
+			return err
+		}
+	}
+	for _, call := range delta.Get("tool_calls").Array() {
+		index := call.Get("index").Int()
+		if s.blockType != "tool_use" || index != s.toolIndex {
+			s.toolIndex = index
+			if err := s.openBlock("tool_use", map[string]any{
+				"type":  "tool_use",
+				"id":    call.Get("id").String(),
+				"name":  call.Get("function.name").String(),
+				"input": map[string]any{},
+			}); err != nil {
+				return err
+			}
+		}
+		if args := call.Get("function.arguments").String(); args != "" {
+			if err := s.emit("content_block_delta", map[string]any{
+				"type":  "content_block_delta",
+				"index": s.blockIndex,
+				"delta": map[string]any{"type": "input_json_delta", "partial_json": args},
+			}); err != nil {
+				return err
+			}
+		}
+	}
+	if reason := choice.Get("finish_reason").String(); reason != "" {
+		s.stopReason = openAIStopReason(reason)
+	}
+	return nil
+}
+
+func (s *openAIStreamState) finish() error {
+	if !s.started {
+		return nil
+	}
+	if err := s.closeBlock(); err != nil {
+		return err
+	}
+	if s.stopReason == "" {
+		s.stopReason = "end_turn"
+	}
+	if err := s.emit("message_delta", map[string]any{
+		"type":  "message_delta",
+		"delta": map[string]any{"stop_reason": s.stopReason, "stop_sequence": nil},
+		"usage": s.usage,
+	}); err != nil {
+		return err
+	}
+	return s.emit("message_stop", map[string]any{"type": "message_stop"})
+}
+
+func openAIToAnthropicStream(r io.Reader, w io.Writer) error {
+	state := &openAIStreamState{w: w}
+	var handleErr error
+	var stopped bool
+	err := scanSSE(r, func(event sseEvent) bool {
+		if event.data == "[DONE]" {
+			return false
+		}
+		chunk := gjson.Parse(event.data)
+		// 流式过程中错误 转为Anthropic的error事件后结束
+		if errMsg := chunk.Get("error"); errMsg.Exists() {
+			handleErr = state.emit("error", map[string]any{
+				"type":  "error",
+				"error": map[string]any{"type": "api_error", "message": errMsg.Get("message").String()},
+			})
+			stopped = true
+			return false
+		}
+		handleErr = state.handle(chunk)
+		return handleErr == nil
+	})
+	if err != nil {
+		return err
+	}
+	if handleErr != nil || stopped {
+		return handleErr
+	}
+	return state.finish()
+}
@@ -0,0 +1,366 @@
+package providers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+// openAIToGeminiRequest OpenAI Chat Completions 请求 -> Gemini generateContent 请求
+func openAIToGeminiRequest(rawBody []byte) ([]byte, error) {
+	req := gjson.ParseBytes(rawBody)
+	if !req.IsObject() {
+		return nil, errors.New("invalid openai request body")
+	}
+
+	systems := make([]map[string]any, 0)
+	contents := make([]map[string]any, 0)
+	// Gemini要求user/model交替出现 相同角色的连续消息合并为一条
+	appendParts := func(role string, parts []map[string]any) {
+		if len(parts) == 0 {
+			return
+		}
+		if n := len(contents); n != 0 && contents[n-1]["role"] == role {
+			contents[n-1]["parts"] = append(contents[n-1]["parts"].([]map[string]any), parts...)
+			return
+		}
+		contents = append(contents, map[string]any{"role": role, "parts": parts})
+	}
+	// functionResponse需要函数名 通过tool_call_id反查
+	toolNames := make(map[string]string)
+
+	for _, message := range req.Get("messages").Array() {
+		content := message.Get("content")
+		switch message.Get("role").String() {
+		case "system", "developer":
+			if text := openAITextOf(content); text != "" {
+				systems = append(systems, map[string]any{"text": text})
+			}
+		case "user":
+			appendParts("user", openAIContentToGemini(content))
+		case "assistant":
+			parts := make([]map[string]any, 0)
+			if text := openAITextOf(content); text != "" {
+				parts = append(parts, map[string]any{"text": text})
+			}
+			for _, call := range message.Get("tool_calls").Array() {
+				name := call.Get("function.name").String()
+				toolNames[call.Get("id").String()] = name
+				args := call.Get("function.arguments").String()
+				if !gjson.Valid(args) || args == "" {
+					args = "{}"
+				}
+				parts = append(parts, map[string]any{"functionCall": map[string]any{
+					"name": name,
+					"args": json.RawMessage(args),
+				}})
+			}
+			appendParts("model", parts)
+		case "tool":
+			id := message.Get("tool_call_id").String()
+			appendParts("user", []map[string]any{{"functionResponse": map[string]any{
+				"name":     toolNames[id],
+				"response": map[string]any{"content": openAITextOf(content)},
+			}}})
+		}
+	}
+
+	out := map[string]any{"contents": contents}
+	if len(systems) != 0 {
+		out["systemInstruction"] = map[string]any{"parts": systems}
+	}
+
+	generationConfig := make(map[string]any)
+	if v := req.Get("max_completion_tokens"); v.Exists() {
+		generationConfig["maxOutputTokens"] = v.Int()
+	} else if v := req.Get("max_tokens"); v.Exists() {
+		generationConfig["maxOutputTokens"] = v.Int()
+	}
+	if v := req.Get("temperature"); v.Exists() {
+		generationConfig["temperature"] = v.Float()
+	}
+	if v := req.Get("top_p"); v.Exists() {
+		generationConfig["topP"] = v.Float()
+	}
+	if v := req.Get("stop"); v.Exists() {
+		stops := make([]string, 0)
+		if v.IsArray() {
+			for _, stop := range v.Array() {
+				stops = append(stops, stop.String())
+			}
+		} else if v.String() != "" {
+			stops = append(stops, v.String())
+		}
+		if len(stops) != 0 {
+			generationConfig["stopSequences"] = stops
+		}
+	}
+	if format := req.Get("response_format"); format.Exists() {
+		switch format.Get("type").String() {
+		case "json_object":
+			generationConfig["responseMimeType"] = "application/json"
+		case "json_schema":
+			generationConfig["responseMimeType"] = "application/json"
+			if schema := format.Get("json_schema.schema"); schema.Exists() {
+				generationConfig["responseJsonSchema"] = json.RawMessage(schema.Raw)
+			}
+		}
+	}
+	if len(generationConfig) != 0 {
+		out["generationConfig"] = generationConfig
+	}
+
+	if tools := req.Get("tools").Array(); len(tools) != 0 {
+		declarations := make([]map[string]any, 0, len(tools))
+		for _, tool := range tools {
+			if tool.Get("type").String() != "function" {
+				continue
+			}
+			function := tool.Get("function")
+			declaration := map[string]any{"name": function.Get("name").String()}
+			if desc := function.Get("description"); desc.Exists() {
+				declaration["description"] = desc.String()
+			}
+			if params := function.Get("parameters"); params.Exists() {
+				declaration["parametersJsonSchema"] = json.RawMessage(params.Raw)
+			}
+			declarations = append(declarations, declaration)
+		}
+		out["tools"] = []map[string]any{{"functionDeclarations": declarations}}
+	}
+	if choice := req.Get("tool_choice"); choice.Exists() {
+		config := make(map[string]any)
+		switch {
+		case choice.Type == gjson.String && choice.String() == "auto":
+			config["mode"] = "AUTO"
+		case choice.Type == gjson.String && choice.String() == "required":
+			config["mode"] = "ANY"
+		case choice.Type == gjson.String && choice.String() == "none":
+			config["mode"] = "NONE"
+		case choice.IsObject():
+			config["mode"] = "ANY"
+			config["allowedFunctionNames"] = []string{choice.Get("function.name").String()}
+		}
+		if len(config) != 0 {
+			out["toolConfig"] = map[string]any{"functionCallingConfig": config}
+		}
+	}
+
+	return json.Marshal(out)
+}
+
+// openAIContentToGemini 将user消息的content转换为Gemini parts
+func openAIContentToGemini(content gjson.Result) []map[string]any {
+	if content.Type == gjson.String {
+		return []map[string]any{{"text": content.String()}}
+	}
+	parts := make([]map[string]any, 0)
+	for _, part := range content.Array() {
+		switch part.Get("type").String() {
+		case "text":
+			parts = append(parts, map[string]any{"text": part.Get("text").String()})
+		case "image_url":
+			source := openAIImageSource(part.Get("image_url.url").String())
+			if source == nil {
+				continue
+			}
+			if source["type"] == "base64" {
+				parts = append(parts, map[string]any{"inlineData": map[string]any{
+					"mimeType": source["media_type"],
+					"data":     source["data"],
+				}})
+				continue
+			}
+			fileURL := source["url"].(string)
+			fileData := map[string]any{"fileUri": fileURL}
+			if mimeType := mime.TypeByExtension(path.Ext(fileURL)); mimeType != "" {
+				fileData["mimeType"] = mimeType
+			}
+			parts = append(parts, map[string]any{"fileData": fileData})
+		}
+	}
+	return parts
+}
+
+// geminiFinishReason Gemini finishReason -> OpenAI finish_reason
+func geminiFinishReason(finishReason string, toolCall bool) string {
+	switch finishReason {
+	case "":
+		return ""
+	case "MAX_TOKENS":
+		return "length"
+	case "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII", "IMAGE_SAFETY":
+		return "content_filter"
+	}
+	if toolCall {
+		return "tool_calls"
+	}
+	return "stop"
+}
+
+// geminiUsageToOpenAI usageMetadata -> OpenAI usage 思考token计入completion_tokens
+func geminiUsageToOpenAI(usage gjson.Result) openAIUsage {
+	prompt := usage.Get("promptTokenCount").Int()
+	completion := usage.Get("candidatesTokenCount").Int() + usage.Get("thoughtsTokenCount").Int()
+	total := usage.Get("totalTokenCount").Int()
+	if total == 0 {
+		total = prompt + completion
+	}
+	return openAIUsage{
+		PromptTokens:     prompt,
+		CompletionTokens: completion,
+		TotalTokens:      total,
+	}
+}
+
+// geminiParts 拆分candidate中的文本/思考/函数调用
+func geminiParts(candidate gjson.Result, toolOffset int) (text, reasoning string, toolCalls []map[string]any) {
+	var textBuilder, reasoningBuilder strings.Builder
+	toolCalls = make([]map[string]any, 0)
+	for _, part := range candidate.Get("content.parts").Array() {
+		if call := part.Get("functionCall"); call.Exists() {
+			args := call.Get("args").Raw
+			if args == "" {
+				args = "{}"
+			}
+			id := call.Get("id").String()
+			if id == "" {
+				id = fmt.Sprintf("call_%d", toolOffset+len(toolCalls))
+			}
+			toolCalls = append(toolCalls, map[string]any{
+				"index": toolOffset + len(toolCalls),
+				"id":    id,
+				"type":  "function",
+				"function": map[string]any{
+					"name":      call.Get("name").String(),
+					"arguments": args,
+				},
+			})
+			continue
+		}
+		if part.Get("thought").Bool() {
+			reasoningBuilder.WriteString(part.Get("text").String())
+			continue
+		}
+		textBuilder.WriteString(part.Get("text").String())
+	}
+	return textBuilder.String(), reasoningBuilder.String(), toolCalls
+}
+
+func geminiToOpenAIResponse(body []byte, model string) ([]byte, error) {
+	res := gjson.ParseBytes(body)
+	if !res.IsObject() {
+		return nil, errors.New("invalid gemini response body")
+	}
+	candidate := res.Get("candidates.0")
+	text, reasoning, toolCalls := geminiParts(candidate, 0)
+
+	message := map[string]any{"role": "assistant", "content": text}
+	if reasoning != "" {
+		message["reasoning_content"] = reasoning
+	}
+	if len(toolCalls) != 0 {
+		for _, call := range toolCalls {
+			delete(call, "index")
+		}
+		message["tool_calls"] = toolCalls
+	}
+
+	return json.Marshal(map[string]any{
+		"id":      res.Get("responseId").String(),
+		"object":  "chat.completion",
+		"created": time.Now().Unix(),
+		"model":   model,
+		"choices": []map[string]any{{
+			"index":         0,
+			"message":       message,
+			"finish_reason": geminiFinishReason(candidate.Get("finishReason").String(), len(toolCalls) != 0),
+		}},
+		"usage": geminiUsageToOpenAI(res.Get("usageMetadata")),
+	})
+}
+
+func geminiToOpenAIStream(r io.Reader, w io.Writer, model string) error {
+	created := time.Now().Unix()
+	var id string
+	var usage gjson.Result
+	var toolCount int
+	writeChunk := func(choices any, extra map[string]any) error {
+		chunk := map[string]any{
+			"id":      id,
+			"object":  "chat.completion.chunk",
+			"created": created,
+			"model":   model,
+			"choices": choices,
+		}
+		for k, v := range extra {
+			chunk[k] = v
+		}
+		raw, err := json.Marshal(chunk)
+		if err != nil {
+			return err
+		}
+		return writeSSE(w, "", raw)
+	}
+
+	var handleErr error
+	var stopped bool
+	err := scanSSE(r, func(event sseEvent) bool {
+		data := gjson.Parse(event.data)
+		// 流式过程中错误 透传为OpenAI风格的error chunk后结束
+		if errMsg := data.Get("error"); errMsg.Exists() {
+			handleErr = writeSSE(w, "", []byte(`{"error":`+errMsg.Raw+`}`))
+			stopped = true
+			return false
+		}
+		if id == "" {
+			id = data.Get("responseId").String()
+		}
+		if u := data.Get("usageMetadata"); u.Exists() {
+			usage = u
+		}
+		candidate := data.Get("candidates.0")
+		if !candidate.Exists() {
+			return true
+		}
+		text, reasoning, toolCalls := geminiParts(candidate, toolCount)
+		toolCount += len(toolCalls)
+		delta := map[string]any{}
+		if text != "" {
+			delta["content"] = text
+		}
+		if reasoning != "" {
+			delta["reasoning_content"] = reasoning
+		}
+		if len(toolCalls) != 0 {
+			delta["tool_calls"] = toolCalls
+		}
+		var finishReason any
+		if reason := geminiFinishReason(candidate.Get("finishReason").String(), toolCount != 0); reason != "" {
+			finishReason = reason
+		}
+		if len(delta) == 0 && finishReason == nil {
+			return true
+		}
+		handleErr = writeChunk([]map[string]any{{"index": 0, "delta": delta, "finish_reason": finishReason}}, nil)
+		return handleErr == nil
+	})
+	if err != nil {
+		return err
+	}
+	if handleErr != nil || stopped {
+		return handleErr
+	}
+	// include_usage风格的用量chunk
+	if err := writeChunk([]any{}, map[string]any{"usage": geminiUsageToOpenAI(usage)}); err != nil {
+		return err
+	}
+	return writeSSE(w, "", []byte("[DONE]"))
+}
@@ -0,0 +1,430 @@
+package providers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+// DefaultAnthropicMaxTokens 客户端未指定max_tokens时的默认值(Anthropic要求必填)
+const DefaultAnthropicMaxTokens = 4096
+
+// OpenAI Chat Completions 客户端 -> Anthropic Messages 上游
+func init() {
+	registerConverter(StyleOpenAI, StyleAnthropic, converter{
+		request:  openAIToAnthropicRequest,
+		response: anthropicToOpenAIResponse,
+		stream:   anthropicToOpenAIStream,
+	})
+}
+
+func openAIToAnthropicRequest(rawBody []byte) ([]byte, error) {
+	req := gjson.ParseBytes(rawBody)
+	if !req.IsObject() {
+		return nil, errors.New("invalid openai request body")
+	}
+
+	systems := make([]string, 0)
+	messages := make([]map[string]any, 0)
+	// Anthropic要求user/assistant交替出现 相同角色的连续消息合并为一条
+	appendBlocks := func(role string, blocks []map[string]any) {
+		if len(blocks) == 0 {
+			return
+		}
+		if n := len(messages); n != 0 && messages[n-1]["role"] == role {
+			messages[n-1]["content"] = append(messages[n-1]["content"].([]map[string]any), blocks...)
+			return
+		}
+		messages = append(messages, map[string]any{"role": role, "content": blocks})
+	}
+
+	for _, message := range req.Get("messages").Array() {
+		content := message.Get("content")
+		switch message.Get("role").String() {
+		case "system", "developer":
+			if text := openAITextOf(content); text != "" {
+				systems = append(systems, text)
+			}
+		case "user":
+			appendBlocks("user", openAIContentToAnthropic(content))
+		case "assistant":
+			blocks := make([]map[string]any, 0)
+			if text := openAITextOf(content); text != "" {
+				blocks = append(blocks, map[string]any{"type": "text", "text": text})
+			}
+			for _, call := range message.Get("tool_calls").Array() {
+				args := call.Get("function.arguments").String()
+				if !gjson.Valid(args) || args == "" {
+					args = "{}"
+				}
+				blocks = append(blocks, map[string]any{
+					"type":  "tool_use",
+					"id":    call.Get("id").String(),
+					"name":  call.Get("function.name").String(),
+					"input": json.RawMessage(args),
+				})
+			}
+			appendBlocks("assistant", blocks)
+		case "tool":
+			appendBlocks("user", []map[string]any{{
+				"type":        "tool_result",
+				"tool_use_id": message.Get("tool_call_id").String(),
+				"content":     openAITextOf(content),
+			}})
+		}
+	}
+
+	// Anthropic没有原生的response_format 通过系统提示约束输出
+	if format := req.Get("response_format"); format.Exists() {
+		switch format.Get("type").String() {
+		case "json_object":
+			systems = append(systems, "Respond only with a valid JSON object.")
+		case "json_schema":
+			systems = append(systems, "Respond only with a valid JSON object that conforms to this JSON schema:\n"+format.Get("json_schema.schema").Raw)
+		}
+	}
+
+	out := map[string]any{
+		"model":    req.Get("model").String(),
+		"messages": messages,
+	}
+	if len(systems) != 0 {
+		out["system"] = strings.Join(systems, "\n\n")
+	}
+	maxTokens := int64(DefaultAnthropicMaxTokens)
+	if v := req.Get("max_completion_tokens"); v.Exists() {
+		maxTokens = v.Int()
+	} else if v := req.Get("max_tokens"); v.Exists() {
+		maxTokens = v.Int()
+	}
+	out["max_tokens"] = maxTokens
+	if v := req.Get("temperature"); v.Exists() {
+		// OpenAI的取值范围为0-2 Anthropic仅接受0-1
+		out["temperature"] = min(max(v.Float(), 0), 1)
+	}
+	if v := req.Get("top_p"); v.Exists() {
+		out["top_p"] = v.Float()
+	}
+	if v := req.Get("stop"); v.Exists() {
+		stops := make([]string, 0)
+		if v.IsArray() {
+			for _, stop := range v.Array() {
+				stops = append(stops, stop.String())
+			}
+		} else if v.String() != "" {
+			stops = append(stops, v.String())
+		}
+		if len(stops) != 0 {
+			out["stop_sequences"] = stops
+		}
+	}
+	if v := req.Get("user"); v.Exists() {
+		out["metadata"] = map[string]any{"user_id": v.String()}
+	}
+	if req.Get("stream").Bool() {
+		out["stream"] = true
+	}
+
+	if tools := req.Get("tools").Array(); len(tools) != 0 {
+		anthropicTools := make([]map[string]any, 0, len(tools))
+		for _, tool := range tools {
+			if tool.Get("type").String() != "function" {
+				continue
+			}
+			function := tool.Get("function")
+			anthropicTool := map[string]any{"name": function.Get("name").String()}
+			if desc := function.Get("description"); desc.Exists() {
+				anthropicTool["description"] = desc.String()
+			}
+			if params := function.Get("parameters"); params.Exists() {
+				anthropicTool["input_schema"] = json.RawMessage(params.Raw)
+			} else {
+				anthropicTool["input_schema"] = map[string]any{"type": "object"}
+			}
+			anthropicTools = append(anthropicTools, anthropicTool)
+		}
+		out["tools"] = anthropicTools
+	}
+	if choice := req.Get("tool_choice"); choice.Exists() {
+		var toolChoice map[string]any
+		switch {
+		case choice.Type == gjson.String && choice.String() == "auto":
+			toolChoice = map[string]any{"type": "auto"}
+		case choice.Type == gjson.String && choice.String() == "required":
+			toolChoice = map[string]any{"type": "any"}
+		case choice.Type == gjson.String && choice.String() == "none":
+			toolChoice = map[string]any{"type": "none"}
+		case choice.IsObject():
+			toolChoice = map[string]any{"type": "tool", "name": choice.Get("function.name").String()}
+		}
+		if toolChoice != nil {
+			if v := req.Get("parallel_tool_calls"); v.Exists() && !v.Bool() {
+				toolChoice["disable_parallel_tool_use"] = true
+			}
+			out["tool_choice"] = toolChoice
+		}
+	}
+
+	return json.Marshal(out)
+}
+
+// openAITextOf 提取字符串或内容片段数组中的文本
+func openAITextOf(content gjson.Result) string {
+	if content.Type == gjson.String {
+		return content.String()
+	}
+	texts := make([]string, 0)
+	for _, part := range content.Array() {
+		if part.Get("type").String() == "text" {
+			texts = append(texts, part.Get("text").String())
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// openAIContentToAnthropic 将user消息的content转换为Anthropic内容块
+func openAIContentToAnthropic(content gjson.Result) []map[string]any {
+	if content.Type == gjson.String {
+		return []map[string]any{{"type": "text", "text": content.String()}}
+	}
+	blocks := make([]map[string]any, 0)
+	for _, part := range content.Array() {
+		switch part.Get("type").String() {
+		case "text":
+			blocks = append(blocks, map[string]any{"type": "text", "text": part.Get("text").String()})
+		case "image_url":
+			if source := openAIImageSource(part.Get("image_url.url").String()); source != nil {
+				blocks = append(blocks, map[string]any{"type": "image", "source": source})
+			}
+		}
+	}
+	return blocks
+}
+
+// openAIImageSource data URL转换为base64来源 其余按url来源处理
+func openAIImageSource(url string) map[string]any {
+	if url == "" {
+		return nil
+	}
+	if rest, ok := strings.CutPrefix(url, "data:"); ok {
+		meta, data, ok := strings.Cut(rest, ",")
+		if !ok {
+			return nil
+		}
+		return map[string]any{
+			"type":       "base64",
+			"media_type": strings.TrimSuffix(meta, ";base64"),
+			"data":       data,
+		}
+	}
+	return map[string]any{"type": "url", "url": url}
+}
+
+// anthropicFinishReason Anthropic stop_reason -> OpenAI finish_reason
+func anthropicFinishReason(stopReason string) string {
+	switch stopReason {
+	case "max_tokens":
+		return "length"
+	case "tool_use":
+		return "tool_calls"
+	case "refusal":
+		return "content_filter"
+	default:
+		return "stop"
+	}
+}
+
+type openAIUsage struct {
+	PromptTokens     int64 `json:"prompt_tokens"`
+	CompletionTokens int64 `json:"completion_tokens"`
+	TotalTokens      int64 `json:"total_tokens"`
+}
+
+// anthropicUsageToOpenAI 缓存命中与写入的token同样计入prompt_tokens
+func anthropicUsageToOpenAI(usage gjson.Result) openAIUsage {
+	prompt := usage.Get("input_tokens").Int() + usage.Get("cache_read_input_tokens").Int() + usage.Get("cache_creation_input_tokens").Int()
+	completion := usage.Get("output_tokens").Int()
+	return openAIUsage{
+		PromptTokens:     prompt,
+		CompletionTokens: completion,
+		TotalTokens:      prompt + completion,
+	}
+}
+
+func anthropicToOpenAIResponse(body []byte) ([]byte, error) {
+	res := gjson.ParseBytes(body)
+	if !res.IsObject() {
+		return nil, errors.New("invalid anthropic response body")
+	}
+
+	var text strings.Builder
+	toolCalls := make([]map[string]any, 0)
+	for _, block := range res.Get("content").Array() {
+		switch block.Get("type").String() {
+		case "text":
+			text.WriteString(block.Get("text").String())
+		case "tool_use":
+			input := block.Get("input").Raw
+			if input == "" {
+				input = "{}"
+			}
+			toolCalls = append(toolCalls, map[string]any{
+				"id":   block.Get("id").String(),
+				"type": "function",
+				"function": map[string]any{
+					"name":      block.Get("name").String(),
+					"arguments": input,
+				},
+			})
+		}
+	}
+	message := map[string]any{"role": "assistant", "content": text.String()}
+	if len(toolCalls) != 0 {
+		message["tool_calls"] = toolCalls
+	}
+
+	return json.Marshal(map[string]any{
+		"id":      res.Get("id").String(),
+		"object":  "chat.completion",
+		"created": time.Now().Unix(),
+		"model":   res.Get("model").String(),
+		"choices": []map[string]any{{
+			"index":         0,
+			"message":       message,
+			"finish_reason": anthropicFinishReason(res.Get("stop_reason").String()),
+		}},
+		"usage": anthropicUsageToOpenAI(res.Get("usage")),
+	})
+}
+
+// anthropicStreamState Anthropic流 -> OpenAI流 的转换状态
+type anthropicStreamState struct {
+	w         io.Writer
+	id        string
+	model     string
+	created   int64
+	toolIndex map[int64]int // Anthropic内容块下标 -> OpenAI tool_calls下标
+	usage     gjson.Result
+	input     gjson.Result
+}
+
+func (s *anthropicStreamState) chunk(delta map[string]any, finishReason any) error {
+	raw, err := json.Marshal(map[string]any{
+		"id":      s.id,
+		"object":  "chat.completion.chunk",
+		"created": s.created,
+		"model":   s.model,
+		"choices": []map[string]any{{"index": 0, "delta": delta, "finish_reason": finishReason}},
+	})
+	if err != nil {
+		return err
+	}
+	return writeSSE(s.w, "", raw)
+}
+
+func (s *anthropicStreamState) handle(event gjson.Result) error {
+	switch event.Get("type").String() {
+	case "message_start":
+		message := event.Get("message")
+		s.id = message.Get("id").String()
+		s.model = message.Get("model").String()
+		s.input = message.Get("usage")
+		return s.chunk(map[string]any{"role": "assistant", "content": ""}, nil)
+	case "content_block_start":
+		block := event.Get("content_block")
+		if block.Get("type").String() != "tool_use" {
+			return nil
+		}
+		index := len(s.toolIndex)
+		s.toolIndex[event.Get("index").Int()] = index
+		return s.chunk(map[string]any{"tool_calls": []map[string]any{{
+			"index":    index,
+			"id":       block.Get("id").String(),
+			"type":     "function",
+			"function": map[string]any{"name": block.Get("name").String(), "arguments": ""},
+		}}}, nil)
+	case "content_block_delta":
+		delta := event.Get("delta")
+		switch delta.Get("type").String() {
+		case "text_delta":
+			return s.chunk(map[string]any{"content": delta.Get("text").String()}, nil)
+		case "thinking_delta":
+			return s.chunk(map[string]any{"reasoning_content": delta.Get("thinking").String()}, nil)
+		case "input_json_delta":
+			index, ok := s.toolIndex[event.Get("index").Int()]
+			if !ok {
+				return nil
+			}
+			return s.chunk(map[string]any{"tool_calls": []map[string]any{{
+				"index":    index,
+				"function": map[string]any{"arguments": delta.Get("partial_json").String()},
+			}}}, nil)
+		}
+	case "message_delta":
+		s.usage = event.Get("usage")
+		return s.chunk(map[string]any{}, anthropicFinishReason(event.Get("delta.stop_reason").String()))
+	}
+	return nil
+}
+
+// finish 输出include_usage风格的用量chunk与结束标记
+func (s *anthropicStreamState) finish() error {
+	usage := anthropicUsageToOpenAI(s.input)
+	output := anthropicUsageToOpenAI(s.usage)
+	// message_delta中的input用量优先(部分上游只在结束时给出)
+	if output.PromptTokens != 0 {
+		usage.PromptTokens = output.PromptTokens
+	}
+	usage.CompletionTokens = output.CompletionTokens
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	raw, err := json.Marshal(map[string]any{
+		"id":      s.id,
+		"object":  "chat.completion.chunk",
+		"created": s.created,
+		"model":   s.model,
+		"choices": []any{},
+		"usage":   usage,
+	})
+	if err != nil {
+		return err
+	}
+	if err := writeSSE(s.w, "", raw); err != nil {
+		return err
+	}
+	return writeSSE(s.w, "", []byte("[DONE]"))
+}
+
+func anthropicToOpenAIStream(r io.Reader, w io.Writer) error {
+	state := &anthropicStreamState{w: w, created: time.Now().Unix(), toolIndex: make(map[int64]int)}
+	var handleErr error
+	var stopped bool
+	err := scanSSE(r, func(event sseEvent) bool {
+		data := gjson.Parse(event.data)
+		switch data.Get("type").String() {
+		case "message_stop":
+			return false
+		case "error":
+			// 流式过程中错误 透传为OpenAI风格的error chunk后结束
+			errRaw := data.Get("error").Raw
+			if errRaw == "" {
+				errRaw = `{"message":"upstream stream error"}`
+			}
+			handleErr = writeSSE(w, "", []byte(`{"error":`+errRaw+`}`))
+			stopped = true
+			return false
+		}
+		handleErr = state.handle(data)
+		return handleErr == nil
+	})
+	if err != nil {
+		return err
+	}
+	if handleErr != nil || stopped {
+		return handleErr
+	}
+	return state.finish()
+}
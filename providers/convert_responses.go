@@ -0,0 +1,482 @@
+package providers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+// OpenAI Responses 客户端 -> OpenAI Chat Completions 上游
+func init() {
+	registerConverter(StyleResponses, StyleOpenAI, converter{
+		request:  responsesToChatRequest,
+		response: chatToResponsesResponse,
+		stream:   chatToResponsesStream,
+	})
+}
+
+func responsesToChatRequest(rawBody []byte) ([]byte, error) {
+	req := gjson.ParseBytes(rawBody)
+	if !req.IsObject() {
+		return nil, errors.New("invalid responses request body")
+	}
+	// Chat Completions是无状态的 无法还原之前的对话
+	if req.Get("previous_response_id").String() != "" {
+		return nil, errors.New("previous_response_id is not supported by chat completions upstreams")
+	}
+
+	messages := make([]map[string]any, 0)
+	if instructions := req.Get("instructions").String(); instructions != "" {
+		messages = append(messages, map[string]any{"role": "system", "content": instructions})
+	}
+	input := req.Get("input")
+	if input.Type == gjson.String {
+		messages = append(messages, map[string]any{"role": "user", "content": input.String()})
+	}
+	for _, item := range input.Array() {
+		if !item.IsObject() {
+			continue
+		}
+		itemType := item.Get("type").String()
+		if itemType == "" && item.Get("role").Exists() {
+			itemType = "message"
+		}
+		switch itemType {
+		case "message":
+			messages = append(messages, responsesMessageToChat(item))
+		case "function_call":
+			call := map[string]any{
+				"id":   item.Get("call_id").String(),
+				"type": "function",
+				"function": map[string]any{
+					"name":      item.Get("name").String(),
+					"arguments": item.Get("arguments").String(),
+				},
+			}
+			// 连续的function_call合并到同一条assistant消息
+			if n := len(messages); n != 0 && messages[n-1]["role"] == "assistant" && messages[n-1]["tool_calls"] != nil {
+				messages[n-1]["tool_calls"] = append(messages[n-1]["tool_calls"].([]map[string]any), call)
+				continue
+			}
+			messages = append(messages, map[string]any{"role": "assistant", "content": nil, "tool_calls": []map[string]any{call}})
+		case "function_call_output":
+			output := item.Get("output")
+			content := output.String()
+			if output.IsArray() {
+				content = responsesTextOf(output)
+			}
+			messages = append(messages, map[string]any{
+				"role":         "tool",
+				"tool_call_id": item.Get("call_id").String(),
+				"content":      content,
+			})
+		}
+	}
+
+	out := map[string]any{
+		"model":    req.Get("model").String(),
+		"messages": messages,
+	}
+	if v := req.Get("max_output_tokens"); v.Exists() {
+		out["max_tokens"] = v.Int()
+	}
+	if v := req.Get("temperature"); v.Exists() {
+		out["temperature"] = v.Float()
+	}
+	if v := req.Get("top_p"); v.Exists() {
+		out["top_p"] = v.Float()
+	}
+	if v := req.Get("user"); v.Exists() {
+		out["user"] = v.String()
+	}
+	if v := req.Get("parallel_tool_calls"); v.Exists() {
+		out["parallel_tool_calls"] = v.Bool()
+	}
+	if req.Get("stream").Bool() {
+		out["stream"] = true
+		out["stream_options"] = map[string]any{"include_usage": true}
+	}
+	if format := req.Get("text.format"); format.Exists() {
+		switch format.Get("type").String() {
+		case "json_object":
+			out["response_format"] = map[string]any{"type": "json_object"}
+		case "json_schema":
+			schema := map[string]any{"name": format.Get("name").String()}
+			if v := format.Get("schema"); v.Exists() {
+				schema["schema"] = json.RawMessage(v.Raw)
+			}
+			if v := format.Get("strict"); v.Exists() {
+				schema["strict"] = v.Bool()
+			}
+			out["response_format"] = map[string]any{"type": "json_schema", "json_schema": schema}
+		}
+	}
+
+	if tools := req.Get("tools").Array(); len(tools) != 0 {
+		chatTools := make([]map[string]any, 0, len(tools))
+		for _, tool := range tools {
+			// 内置工具(web_search等)无法在Chat Completions中使用
+			if tool.Get("type").String() != "function" {
+				continue
+			}
+			function := map[string]any{"name": tool.Get("name").String()}
+			if v := tool.Get("description"); v.Exists() {
+				function["description"] = v.String()
+			}
+			if v := tool.Get("parameters"); v.Exists() {
+				function["parameters"] = json.RawMessage(v.Raw)
+			}
+			if v := tool.Get("strict"); v.Exists() {
+				function["strict"] = v.Bool()
+			}
+			chatTools = append(chatTools, map[string]any{"type": "function", "function": function})
+		}
+		if len(chatTools) != 0 {
+			out["tools"] = chatTools
+		}
+	}
+	if choice := req.Get("tool_choice"); choice.Exists() {
+		if choice.Type == gjson.String {
+			out["tool_choice"] = choice.String()
+		} else if choice.Get("type").String() == "function" {
+			out["tool_choice"] = map[string]any{
+				"type":     "function",
+				"function": map[string]any{"name": choice.Get("name").String()},
+			}
+		}
+	}
+
+	return json.Marshal(out)
+}
+
+// responsesMessageToChat Responses的message输入项 -> Chat消息
+func responsesMessageToChat(item gjson.Result) map[string]any {
+	role := item.Get("role").String()
+	if role == "developer" {
+		role = "system"
+	}
+	content := item.Get("content")
+	if content.Type == gjson.String || role != "user" {
+		text := content.String()
+		if content.IsArray() {
+			text = responsesTextOf(content)
+		}
+		return map[string]any{"role": role, "content": text}
+	}
+	parts := make([]map[string]any, 0)
+	for _, part := range content.Array() {
+		switch part.Get("type").String() {
+		case "input_text", "output_text":
+			parts = append(parts, map[string]any{"type": "text", "text": part.Get("text").String()})
+		case "input_image":
+			imageURL := map[string]any{"url": part.Get("image_url").String()}
+			if detail := part.Get("detail").String(); detail != "" {
+				imageURL["detail"] = detail
+			}
+			parts = append(parts, map[string]any{"type": "image_url", "image_url": imageURL})
+		}
+	}
+	return map[string]any{"role": role, "content": parts}
+}
+
+// responsesTextOf 提取内容片段数组中的文本
+func responsesTextOf(content gjson.Result) string {
+	texts := make([]string, 0)
+	for _, part := range content.Array() {
+		switch part.Get("type").String() {
+		case "input_text", "output_text", "text":
+			texts = append(texts, part.Get("text").String())
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+type responsesUsage struct {
+	InputTokens        int64 `json:"input_tokens"`
+	OutputTokens       int64 `json:"output_tokens"`
+	TotalTokens        int64 `json:"total_tokens"`
+	InputTokensDetails struct {
+		CachedTokens int64 `json:"cached_tokens"`
+	} `json:"input_tokens_details"`
+	OutputTokensDetails struct {
+		ReasoningTokens int64 `json:"reasoning_tokens"`
+	} `json:"output_tokens_details"`
+}
+
+func chatUsageToResponses(usage gjson.Result) responsesUsage {
+	var res responsesUsage
+	res.InputTokens = usage.Get("prompt_tokens").Int()
+	res.OutputTokens = usage.Get("completion_tokens").Int()
+	res.TotalTokens = usage.Get("total_tokens").Int()
+	res.InputTokensDetails.CachedTokens = usage.Get("prompt_tokens_details.cached_tokens").Int()
+	res.OutputTokensDetails.ReasoningTokens = usage.Get("completion_tokens_details.reasoning_tokens").Int()
+	return res
+}
+
+// responsesObject 构造Response对象 finish_reason为length时标记为incomplete
+func responsesObject(id, model string, createdAt int64, output []map[string]any, finishReason string, usage any) map[string]any {
+	res := map[string]any{
+		"id":                 id,
+		"object":             "response",
+		"created_at":         createdAt,
+		"status":             "completed",
+		"model":              model,
+		"output":             output,
+		"incomplete_details": nil,
+		"usage":              usage,
+	}
+	if finishReason == "length" {
+		res["status"] = "incomplete"
+		res["incomplete_details"] = map[string]any{"reason": "max_output_tokens"}
+	}
+	return res
+}
+
+func responsesMessageItem(id, text, status string) map[string]any {
+	return map[string]any{
+		"type":    "message",
+		"id":      id,
+		"status":  status,
+		"role":    "assistant",
+		"content": []map[string]any{responsesTextPart(text)},
+	}
+}
+
+func responsesTextPart(text string) map[string]any {
+	return map[string]any{"type": "output_text", "text": text, "annotations": []any{}}
+}
+
+func responsesFunctionCallItem(id, callID, name, arguments, status string) map[string]any {
+	return map[string]any{
+		"type":      "function_call",
+		"id":        id,
+		"call_id":   callID,
+		"name":      name,
+		"arguments": arguments,
+		"status":    status,
+	}
+}
+
+func chatToResponsesResponse(body []byte) ([]byte, error) {
+	res := gjson.ParseBytes(body)
+	if !res.IsObject() {
+		return nil, errors.New("invalid chat completions response body")
+	}
+	id := res.Get("id").String()
+	choice := res.Get("choices.0")
+	message := choice.Get("message")
+
+	output := make([]map[string]any, 0)
+	if text := message.Get("content").String(); text != "" {
+		output = append(output, responsesMessageItem("msg_"+id, text, "completed"))
+	}
+	for i, call := range message.Get("tool_calls").Array() {
+		output = append(output, responsesFunctionCallItem(
+			fmt.Sprintf("fc_%s_%d", id, i),
+			call.Get("id").String(),
+			call.Get("function.name").String(),
+			call.Get("function.arguments").String(),
+			"completed",
+		))
+	}
+
+	createdAt := res.Get("created").Int()
+	if createdAt == 0 {
+		createdAt = time.Now().Unix()
+	}
+	return json.Marshal(responsesObject("resp_"+id, res.Get("model").String(), createdAt, output, choice.Get("finish_reason").String(), chatUsageToResponses(res.Get("usage"))))
+}
+
+// chatStreamState Chat流 -> Responses流 的转换状态
+type chatStreamState struct {
+	w         io.Writer
+	id        string
+	model     string
+	createdAt int64
+	sequence  int
+	started   bool
+	output    []map[string]any // 已完成的输出项
+	text      *strings.Builder // 当前打开的message输出项 nil表示没有
+	textID    string
+	call      map[string]any // 当前打开的function_call输出项 nil表示没有
+	callIndex int64
+	finish    string
+	usage     any
+}
+
+func (s *chatStreamState) emit(eventType string, data map[string]any) error {
+	data["type"] = eventType
+	data["sequence_number"] = s.sequence
+	s.sequence++
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return writeSSE(s.w, eventType, raw)
+}
+
+func (s *chatStreamState) response(status string) map[string]any {
+	res := responsesObject("resp_"+s.id, s.model, s.createdAt, s.output, s.finish, s.usage)
+	if status != "" {
+		res["status"] = status
+	}
+	return res
+}
+
+func (s *chatStreamState) start(chunk gjson.Result) error {
+	if s.started {
+		return nil
+	}
+	s.started = true
+	s.id = chunk.Get("id").String()
+	s.model = chunk.Get("model").String()
+	if created := chunk.Get("created").Int(); created != 0 {
+		s.createdAt = created
+	}
+	if err := s.emit("response.created", map[string]any{"response": s.response("in_progress")}); err != nil {
+		return err
+	}
+	return s.emit("response.in_progress", map[string]any{"response": s.response("in_progress")})
+}
+
+// closeItem 结束当前打开的输出项
+func (s *chatStreamState) closeItem() error {
+	index := len(s.output)
+	if s.text != nil {
+		text := s.text.String()
+		s.text = nil
+		itemID := s.textID
+		if err := s.emit("response.output_text.done", map[string]any{"item_id": itemID, "output_index": index, "content_index": 0, "text": text}); err != nil {
+			return err
+		}
+		if err := s.emit("response.content_part.done", map[string]any{"item_id": itemID, "output_index": index, "content_index": 0, "part": responsesTextPart(text)}); err != nil {
+			return err
+		}
+		item := responsesMessageItem(itemID, text, "completed")
+		s.output = append(s.output, item)
+		return s.emit("response.output_item.done", map[string]any{"output_index": index, "item": item})
+	}
+	if s.call != nil {
+		item := s.call
+		s.call = nil
+		item["status"] = "completed"
+		if err := s.emit("response.function_call_arguments.done", map[string]any{"item_id": item["id"], "output_index": index, "arguments": item["arguments"]}); err != nil {
+			return err
+		}
+		s.output = append(s.output, item)
+		return s.emit("response.output_item.done", map[string]any{"output_index": index, "item": item})
+	}
+	return nil
+}
+
+func (s *chatStreamState) handle(chunk gjson.Result) error {
+	if err := s.start(chunk); err != nil {
+		return err
+	}
+	if usage := chunk.Get("usage"); usage.Exists() && usage.Type != gjson.Null {
+		s.usage = chatUsageToResponses(usage)
+	}
+	choice := chunk.Get("choices.0")
+	if !choice.Exists() {
+		return nil
+	}
+	delta := choice.Get("delta")
+	index := len(s.output)
+	if text := delta.Get("content").String(); text != "" {
+		if s.text == nil {
+			if err := s.closeItem(); err != nil {
+				return err
+			}
+			index = len(s.output)
+			s.text = &strings.Builder{}
+			s.textID = fmt.Sprintf("msg_%s_%d", s.id, index)
+			if err := s.emit("response.output_item.added", map[string]any{"output_index": index, "item": map[string]any{
+				"type": "message", "id": s.textID, "status": "in_progress", "role": "assistant", "content": []any{},
+			}}); err != nil {
+				return err
+			}
+			if err := s.emit("response.content_part.added", map[string]any{"item_id": s.textID, "output_index": index, "content_index": 0, "part": responsesTextPart("")}); err != nil {
+				return err
+			}
+		}
+		s.text.WriteString(text)
+		if err := s.emit("response.output_text.delta", map[string]any{"item_id": s.textID, "output_index": index, "content_index": 0, "delta": text}); err != nil {
+			return err
+		}
+	}
+	for _, call := range delta.Get("tool_calls").Array() {
+		callIndex := call.Get("index").Int()
+		if s.call == nil || callIndex != s.callIndex {
+			if err := s.closeItem(); err != nil {
+				return err
+			}
+			index = len(s.output)
+			s.callIndex = callIndex
+			s.call = responsesFunctionCallItem(fmt.Sprintf("fc_%s_%d", s.id, callIndex), call.Get("id").String(), call.Get("function.name").String(), "", "in_progress")
+			if err := s.emit("response.output_item.added", map[string]any{"output_index": index, "item": s.call}); err != nil {
+				return err
+			}
+		}
+		if args := call.Get("function.arguments").String(); args != "" {
+			s.call["arguments"] = s.call["arguments"].(string) + args
+			if err := s.emit("response.function_call_arguments.delta", map[string]any{"item_id": s.call["id"], "output_index": index, "delta": args}); err != nil {
+				return err
+			}
+		}
+	}
+	if reason := choice.Get("finish_reason").String(); reason != "" {
+		s.finish = reason
+	}
+	return nil
+}
+
+func (s *chatStreamState) done() error {
+	if !s.started {
+		return nil
+	}
+	if err := s.closeItem(); err != nil {
+		return err
+	}
+	res := s.response("")
+	event := "response.completed"
+	if res["status"] == "incomplete" {
+		event = "response.incomplete"
+	}
+	return s.emit(event, map[string]any{"response": res})
+}
+
+func chatToResponsesStream(r io.Reader, w io.Writer) error {
+	state := &chatStreamState{w: w, createdAt: time.Now().Unix(), output: make([]map[string]any, 0)}
+	var handleErr error
+	var stopped bool
+	err := scanSSE(r, func(event sseEvent) bool {
+		if event.data == "[DONE]" {
+			return false
+		}
+		chunk := gjson.Parse(event.data)
+		// 流式过程中错误 转为Responses的error事件后结束
+		if errMsg := chunk.Get("error"); errMsg.Exists() {
+			handleErr = state.emit("error", map[string]any{
+				"code":    errMsg.Get("code").Value(),
+				"message": errMsg.Get("message").String(),
+				"param":   nil,
+			})
+			stopped = true
+			return false
+		}
+		handleErr = state.handle(chunk)
+		return handleErr == nil
+	})
+	if err != nil {
+		return err
+	}
+	if handleErr != nil || stopped {
+		return handleErr
+	}
+	return state.done()
+}
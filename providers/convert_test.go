@@ -0,0 +1,279 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestAnthropicToOpenAIRequest(t *testing.T) {
+	raw := `{
+		"model": "claude-sonnet",
+		"max_tokens": 1024,
+		"stream": true,
+		"system": [{"type": "text", "text": "you are a helper"}],
+		"tools": [{"name": "get_weather", "description": "weather", "input_schema": {"type": "object"}}],
+		"tool_choice": {"type": "any"},
+		"messages": [
+			{"role": "user", "content": [
+				{"type": "text", "text": "look"},
+				{"type": "image", "source": {"type": "base64", "media_type": "image/png", "data": "AAAA"}}
+			]},
+			{"role": "assistant", "content": [{"type": "tool_use", "id": "call_1", "name": "get_weather", "input": {"location": "nanjing"}}]},
+			{"role": "user", "content": [{"type": "tool_result", "tool_use_id": "call_1", "content": "sunny"}]}
+		]
+	}`
+	body, err := anthropicToOpenAIRequest([]byte(raw))
+	if err != nil {
+		t.Fatalf("convert request: %v", err)
+	}
+	req := gjson.ParseBytes(body)
+
+	if got := req.Get("messages.0.role").String(); got != "system" {
+		t.Errorf("expected system message first, got %s", got)
+	}
+	if got := req.Get("messages.1.content.1.image_url.url").String(); got != "data:image/png;base64,AAAA" {
+		t.Errorf("unexpected image url %s", got)
+	}
+	if got := req.Get("messages.2.tool_calls.0.function.arguments").String(); got != `{"location": "nanjing"}` {
+		t.Errorf("unexpected tool arguments %s", got)
+	}
+	if got := req.Get("messages.3.role").String(); got != "tool" {
+		t.Errorf("expected tool message, got %s", got)
+	}
+	if got := req.Get("tool_choice").String(); got != "required" {
+		t.Errorf("expected tool_choice required, got %s", got)
+	}
+	if !req.Get("stream_options.include_usage").Bool() {
+		t.Error("expected include_usage for stream request")
+	}
+}
+
+func TestOpenAIToAnthropicStream(t *testing.T) {
+	upstream := strings.Join([]string{
+		`data: {"id":"1","model":"gpt","choices":[{"index":0,"delta":{"role":"assistant","content":"Hi"}}]}`,
+		`data: {"id":"1","model":"gpt","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","function":{"name":"f","arguments":""}}]}}]}`,
+		`data: {"id":"1","model":"gpt","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{}"}}]}}]}`,
+		`data: {"id":"1","model":"gpt","choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+		`data: {"id":"1","model":"gpt","choices":[],"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}`,
+		`data: [DONE]`,
+	}, "\n\n")
+
+	var out bytes.Buffer
+	if err := openAIToAnthropicStream(strings.NewReader(upstream), &out); err != nil {
+		t.Fatalf("convert stream: %v", err)
+	}
+
+	events := make([]sseEvent, 0)
+	scanSSE(&out, func(event sseEvent) bool {
+		events = append(events, event)
+		return true
+	})
+	names := make([]string, 0, len(events))
+	for _, event := range events {
+		names = append(names, event.event)
+	}
+	want := []string{
+		"message_start",
+		"content_block_start", "content_block_delta", "content_block_stop",
+		"content_block_start", "content_block_delta", "content_block_stop",
+		"message_delta", "message_stop",
+	}
+	if strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Fatalf("unexpected events %v", names)
+	}
+	delta := gjson.Parse(events[7].data)
+	if got := delta.Get("delta.stop_reason").String(); got != "tool_use" {
+		t.Errorf("expected stop_reason tool_use, got %s", got)
+	}
+	if delta.Get("usage.input_tokens").Int() != 10 || delta.Get("usage.output_tokens").Int() != 5 {
+		t.Errorf("unexpected usage %s", delta.Get("usage").Raw)
+	}
+}
+
+func TestOpenAIToAnthropicRequest(t *testing.T) {
+	raw := `{
+		"model": "gpt-4o",
+		"messages": [
+			{"role": "system", "content": "be brief"},
+			{"role": "user", "content": [
+				{"type": "text", "text": "what is this"},
+				{"type": "image_url", "image_url": {"url": "data:image/jpeg;base64,BBBB"}}
+			]},
+			{"role": "assistant", "content": null, "tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "lookup", "arguments": "{\"q\":1}"}}]},
+			{"role": "tool", "tool_call_id": "call_1", "content": "42"},
+			{"role": "tool", "tool_call_id": "call_2", "content": "43"}
+		],
+		"tools": [{"type": "function", "function": {"name": "lookup", "parameters": {"type": "object"}}}],
+		"tool_choice": "required",
+		"response_format": {"type": "json_object"},
+		"temperature": 1.2
+	}`
+	body, err := openAIToAnthropicRequest([]byte(raw))
+	if err != nil {
+		t.Fatalf("convert request: %v", err)
+	}
+	req := gjson.ParseBytes(body)
+
+	if got := req.Get("max_tokens").Int(); got != DefaultAnthropicMaxTokens {
+		t.Errorf("expected default max_tokens, got %d", got)
+	}
+	if got := req.Get("temperature").Float(); got != 1 {
+		t.Errorf("expected temperature clamped to 1, got %v", got)
+	}
+	if system := req.Get("system").String(); !strings.Contains(system, "be brief") || !strings.Contains(system, "JSON") {
+		t.Errorf("unexpected system prompt %q", system)
+	}
+	if got := req.Get("messages.0.content.1.source.media_type").String(); got != "image/jpeg" {
+		t.Errorf("unexpected image media type %s", got)
+	}
+	if got := req.Get("messages.1.content.0.input.q").Int(); got != 1 {
+		t.Errorf("unexpected tool input %s", req.Get("messages.1.content.0").Raw)
+	}
+	// 连续的tool消息合并为一条user消息
+	if got := len(req.Get("messages.2.content").Array()); got != 2 {
+		t.Errorf("expected 2 tool results in one message, got %d", got)
+	}
+	if got := req.Get("tool_choice.type").String(); got != "any" {
+		t.Errorf("expected tool_choice any, got %s", got)
+	}
+}
+
+func TestAnthropicToOpenAIStream(t *testing.T) {
+	upstream := strings.Join([]string{
+		"event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"id\":\"msg_1\",\"model\":\"claude\",\"usage\":{\"input_tokens\":12,\"output_tokens\":1}}}",
+		"event: content_block_start\ndata: {\"type\":\"content_block_start\",\"index\":0,\"content_block\":{\"type\":\"text\",\"text\":\"\"}}",
+		"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"Hello\"}}",
+		"event: content_block_stop\ndata: {\"type\":\"content_block_stop\",\"index\":0}",
+		"event: message_delta\ndata: {\"type\":\"message_delta\",\"delta\":{\"stop_reason\":\"end_turn\"},\"usage\":{\"output_tokens\":7}}",
+		"event: message_stop\ndata: {\"type\":\"message_stop\"}",
+	}, "\n\n")
+
+	var out bytes.Buffer
+	if err := anthropicToOpenAIStream(strings.NewReader(upstream), &out); err != nil {
+		t.Fatalf("convert stream: %v", err)
+	}
+
+	chunks := make([]string, 0)
+	scanSSE(&out, func(event sseEvent) bool {
+		chunks = append(chunks, event.data)
+		return true
+	})
+	if len(chunks) < 2 || chunks[len(chunks)-1] != "[DONE]" {
+		t.Fatalf("expected stream to end with [DONE], got %v", chunks)
+	}
+	if got := gjson.Get(chunks[1], "choices.0.delta.content").String(); got != "Hello" {
+		t.Errorf("unexpected content %s", got)
+	}
+	usage := gjson.Get(chunks[len(chunks)-2], "usage")
+	if usage.Get("prompt_tokens").Int() != 12 || usage.Get("completion_tokens").Int() != 7 || usage.Get("total_tokens").Int() != 19 {
+		t.Errorf("unexpected usage %s", usage.Raw)
+	}
+}
+
+func TestResponsesToChatRequest(t *testing.T) {
+	raw := `{
+		"model": "gpt-4.1",
+		"instructions": "be brief",
+		"max_output_tokens": 256,
+		"input": [
+			{"role": "user", "content": [{"type": "input_text", "text": "weather?"}]},
+			{"type": "function_call", "call_id": "call_1", "name": "get_weather", "arguments": "{}"},
+			{"type": "function_call_output", "call_id": "call_1", "output": "sunny"}
+		],
+		"tools": [{"type": "function", "name": "get_weather", "parameters": {"type": "object"}}]
+	}`
+	body, err := responsesToChatRequest([]byte(raw))
+	if err != nil {
+		t.Fatalf("convert request: %v", err)
+	}
+	req := gjson.ParseBytes(body)
+
+	if got := req.Get("messages.0.role").String(); got != "system" {
+		t.Errorf("expected system message first, got %s", got)
+	}
+	if got := req.Get("max_tokens").Int(); got != 256 {
+		t.Errorf("expected max_tokens 256, got %d", got)
+	}
+	if got := req.Get("messages.2.tool_calls.0.function.name").String(); got != "get_weather" {
+		t.Errorf("unexpected tool call %s", req.Get("messages.2").Raw)
+	}
+	if got := req.Get("messages.3.tool_call_id").String(); got != "call_1" {
+		t.Errorf("unexpected tool result %s", req.Get("messages.3").Raw)
+	}
+	if got := req.Get("tools.0.function.name").String(); got != "get_weather" {
+		t.Errorf("unexpected tools %s", req.Get("tools").Raw)
+	}
+
+	if _, err := responsesToChatRequest([]byte(`{"model":"gpt","previous_response_id":"resp_1","input":"hi"}`)); err == nil {
+		t.Error("expected previous_response_id to be rejected")
+	}
+}
+
+func TestChatToResponsesStream(t *testing.T) {
+	upstream := strings.Join([]string{
+		`data: {"id":"1","model":"gpt","choices":[{"index":0,"delta":{"role":"assistant","content":"Hi"}}]}`,
+		`data: {"id":"1","model":"gpt","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`,
+		`data: {"id":"1","model":"gpt","choices":[],"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}`,
+		`data: [DONE]`,
+	}, "\n\n")
+
+	var out bytes.Buffer
+	if err := chatToResponsesStream(strings.NewReader(upstream), &out); err != nil {
+		t.Fatalf("convert stream: %v", err)
+	}
+
+	events := make([]sseEvent, 0)
+	scanSSE(&out, func(event sseEvent) bool {
+		events = append(events, event)
+		return true
+	})
+	names := make([]string, 0, len(events))
+	for _, event := range events {
+		names = append(names, event.event)
+	}
+	want := []string{
+		"response.created", "response.in_progress",
+		"response.output_item.added", "response.content_part.added", "response.output_text.delta",
+		"response.output_text.done", "response.content_part.done", "response.output_item.done",
+		"response.completed",
+	}
+	if strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Fatalf("unexpected events %v", names)
+	}
+	completed := gjson.Parse(events[len(events)-1].data)
+	if got := completed.Get("response.output.0.content.0.text").String(); got != "Hi" {
+		t.Errorf("unexpected output %s", completed.Get("response.output").Raw)
+	}
+	if completed.Get("response.usage.input_tokens").Int() != 10 || completed.Get("response.usage.total_tokens").Int() != 15 {
+		t.Errorf("unexpected usage %s", completed.Get("response.usage").Raw)
+	}
+}
+
+func TestConvertInvalidRequest(t *testing.T) {
+	provider, err := NewWithStyle(StyleAnthropic, "openai", `{"base_url":"http://127.0.0.1:0","api_key":"test-key"}`)
+	if err != nil {
+		t.Fatalf("new provider: %v", err)
+	}
+	_, err = provider.Chat(context.Background(), http.DefaultClient, "gpt", []byte(`[]`))
+	if !errors.Is(err, ErrInvalidRequest) {
+		t.Errorf("expected ErrInvalidRequest, got %v", err)
+	}
+}
+
+func TestSupportsNativeResponses(t *testing.T) {
+	if SupportsNativeResponses("openai", `{"base_url":"http://localhost","api_key":"k"}`) {
+		t.Error("openai without responses flag should not be native")
+	}
+	if !SupportsNativeResponses("openai", `{"base_url":"http://localhost","api_key":"k","responses":true}`) {
+		t.Error("openai with responses flag should be native")
+	}
+	if SupportsNativeResponses("anthropic", `{"base_url":"http://localhost","api_key":"k"}`) {
+		t.Error("anthropic should not be native")
+	}
+}
@@ -0,0 +1,43 @@
+package providers
+
+import (
+	"context"
+	"net/http"
+)
+
+// embeddingsTypes 提供Embeddings接口的提供商类型 Embeddings请求不做协议转换
+var embeddingsTypes = map[string]bool{
+	"openai": true,
+	"azure":  true,
+}
+
+// EmbeddingsProvider 支持OpenAI风格Embeddings接口的Provider
+type EmbeddingsProvider interface {
+	Provider
+	Embeddings(ctx context.Context, client *http.Client, model string, rawBody []byte) (*http.Response, error)
+}
+
+// nativeEmbeddings 返回将Chat调用转发到Embeddings接口的Provider
+func nativeEmbeddings(provider Provider) (Provider, bool) {
+	if wrapper, ok := provider.(*PooledProviderWrapper); ok {
+		provider = wrapper.GetUnderlyingProvider()
+	}
+	embeddings, ok := provider.(EmbeddingsProvider)
+	if !ok {
+		return nil, false
+	}
+	return &embeddingsPassthrough{provider: embeddings}, true
+}
+
+// embeddingsPassthrough 将Chat调用转发到上游的Embeddings接口
+type embeddingsPassthrough struct {
+	provider EmbeddingsProvider
+}
+
+func (p *embeddingsPassthrough) Chat(ctx context.Context, client *http.Client, model string, rawBody []byte) (*http.Response, error) {
+	return p.provider.Embeddings(ctx, client, model, rawBody)
+}
+
+func (p *embeddingsPassthrough) Models(ctx context.Context) ([]Model, error) {
+	return p.provider.Models(ctx)
+}
@@ -0,0 +1,47 @@
+package providers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestEmbeddingsStyle(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/embeddings" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		body, _ := io.ReadAll(r.Body)
+		if got := gjson.GetBytes(body, "model").String(); got != "text-embedding-3-small" {
+			t.Errorf("unexpected model %s", got)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"object":"list","data":[{"object":"embedding","index":0,"embedding":[0.1,0.2]}],"usage":{"prompt_tokens":2,"total_tokens":2}}`)
+	}))
+	defer server.Close()
+
+	if !Supports("openai", StyleEmbeddings) || Supports("anthropic", StyleEmbeddings) {
+		t.Fatal("unexpected embeddings support")
+	}
+	if _, err := NewWithStyle(StyleEmbeddings, "anthropic", `{}`); err == nil {
+		t.Error("expected anthropic to reject embeddings")
+	}
+
+	provider, err := NewWithStyle(StyleEmbeddings, "openai", `{"base_url":"`+server.URL+`","api_key":"test-key"}`)
+	if err != nil {
+		t.Fatalf("new provider: %v", err)
+	}
+	res, err := provider.Chat(context.Background(), server.Client(), "text-embedding-3-small", []byte(`{"model":"embed","input":"hi"}`))
+	if err != nil {
+		t.Fatalf("embeddings: %v", err)
+	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(res.Body)
+	if got := gjson.GetBytes(body, "data.0.embedding.1").Float(); got != 0.2 {
+		t.Errorf("unexpected embedding %s", body)
+	}
+}
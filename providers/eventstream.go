@@ -0,0 +1,112 @@
+package providers
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// AWS event-stream 二进制帧格式:
+// | total length(4) | headers length(4) | prelude crc(4) | headers | payload | message crc(4) |
+const (
+	eventStreamPreludeLen = 12
+	eventStreamMaxMessage = 1024 * 1024 * 16
+)
+
+// eventStreamMessage 一条event-stream消息
+type eventStreamMessage struct {
+	headers map[string]string
+	payload []byte
+}
+
+// readEventStreamMessage 读取并校验一条event-stream消息 流结束时返回io.EOF
+func readEventStreamMessage(r io.Reader) (*eventStreamMessage, error) {
+	prelude := make([]byte, eventStreamPreludeLen)
+	if _, err := io.ReadFull(r, prelude); err != nil {
+		return nil, err
+	}
+	totalLen := binary.BigEndian.Uint32(prelude[0:4])
+	headersLen := binary.BigEndian.Uint32(prelude[4:8])
+	if crc32.ChecksumIEEE(prelude[0:8]) != binary.BigEndian.Uint32(prelude[8:12]) {
+		return nil, errors.New("event stream prelude checksum mismatch")
+	}
+	if totalLen < eventStreamPreludeLen+4 || totalLen > eventStreamMaxMessage {
+		return nil, fmt.Errorf("invalid event stream message length %d", totalLen)
+	}
+	// 不做加法比较 避免headersLen过大时uint32溢出
+	if headersLen > totalLen-eventStreamPreludeLen-4 {
+		return nil, fmt.Errorf("invalid event stream headers length %d", headersLen)
+	}
+
+	rest := make([]byte, totalLen-eventStreamPreludeLen)
+	if _, err := io.ReadFull(r, rest); err != nil {
+		return nil, err
+	}
+	crc := crc32.NewIEEE()
+	crc.Write(prelude)
+	crc.Write(rest[:len(rest)-4])
+	if crc.Sum32() != binary.BigEndian.Uint32(rest[len(rest)-4:]) {
+		return nil, errors.New("event stream message checksum mismatch")
+	}
+
+	headers, err := parseEventStreamHeaders(rest[:headersLen])
+	if err != nil {
+		return nil, err
+	}
+	return &eventStreamMessage{
+		headers: headers,
+		payload: rest[headersLen : len(rest)-4],
+	}, nil
+}
+
+// parseEventStreamHeaders 解析header 只保留字符串类型的值 其余类型跳过
+func parseEventStreamHeaders(data []byte) (map[string]string, error) {
+	headers := make(map[string]string)
+	for len(data) > 0 {
+		nameLen := int(data[0])
+		if len(data) < 1+nameLen+1 {
+			return nil, errors.New("truncated event stream header")
+		}
+		name := string(data[1 : 1+nameLen])
+		valueType := data[1+nameLen]
+		data = data[2+nameLen:]
+
+		var size int
+		switch valueType {
+		case 0, 1: // bool true/false
+			size = 0
+		case 2: // byte
+			size = 1
+		case 3: // short
+			size = 2
+		case 4: // integer
+			size = 4
+		case 5, 8: // long, timestamp
+			size = 8
+		case 9: // uuid
+			size = 16
+		case 6, 7: // byte array, string
+			if len(data) < 2 {
+				return nil, errors.New("truncated event stream header")
+			}
+			valueLen := int(binary.BigEndian.Uint16(data[0:2]))
+			if len(data) < 2+valueLen {
+				return nil, errors.New("truncated event stream header")
+			}
+			if valueType == 7 {
+				headers[name] = string(data[2 : 2+valueLen])
+			}
+			data = data[2+valueLen:]
+			continue
+		default:
+			return nil, fmt.Errorf("unknown event stream header type %d", valueType)
+		}
+		if len(data) < size {
+			return nil, errors.New("truncated event stream header")
+		}
+		data = data[size:]
+	}
+	return headers, nil
+}
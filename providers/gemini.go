@@ -0,0 +1,149 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+type Gemini struct {
+	BaseURL string `json:"base_url"`
+	Keys
+	Outbound
+	Overrides
+}
+
+// setAuth 设置x-goog-api-key认证头
+func (g *Gemini) setAuth(header http.Header, key string) {
+	header.Set("x-goog-api-key", key)
+}
+
+// GetHost 获取Gemini的主机地址
+func (g *Gemini) GetHost() string {
+	return g.BaseURL
+}
+
+// GetTimeout 获取请求超时时间
+func (g *Gemini) GetTimeout() time.Duration {
+	return 30 * time.Second
+}
+
+// Chat 接受OpenAI风格的请求体 转换为generateContent请求 并将响应转换回OpenAI风格
+func (g *Gemini) Chat(ctx context.Context, client *http.Client, model string, rawBody []byte) (*http.Response, error) {
+	body, err := openAIToGeminiRequest(rawBody)
+	if err != nil {
+		return nil, fmt.Errorf("%w: convert request error: %v", ErrInvalidRequest, err)
+	}
+	// 覆盖作用于转换后的generateContent请求体
+	if body, err = g.applyBody(body); err != nil {
+		return nil, err
+	}
+	stream := gjson.GetBytes(rawBody, "stream").Bool()
+	endpoint := fmt.Sprintf("%s/models/%s:generateContent", g.BaseURL, url.PathEscape(model))
+	if stream {
+		endpoint = fmt.Sprintf("%s/models/%s:streamGenerateContent?alt=sse", g.BaseURL, url.PathEscape(model))
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	g.applyHeaders(req.Header)
+	res, err := g.do(client, req, g.setAuth)
+	if err != nil {
+		return nil, err
+	}
+	// 非200响应保持原样 由调用方记录错误
+	if res.StatusCode != http.StatusOK {
+		return res, nil
+	}
+	res.Header.Del("Content-Length")
+	res.ContentLength = -1
+	if stream {
+		res.Body = convertStream(res.Body, func(r io.Reader, w io.Writer) error {
+			return geminiToOpenAIStream(r, w, model)
+		})
+		return res, nil
+	}
+	data, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	converted, err := geminiToOpenAIResponse(data, model)
+	if err != nil {
+		return nil, fmt.Errorf("convert response error: %w", err)
+	}
+	res.Body = io.NopCloser(bytes.NewReader(converted))
+	return res, nil
+}
+
+type GeminiModelsResponse struct {
+	Models        []GeminiModel `json:"models"`
+	NextPageToken string        `json:"nextPageToken"`
+}
+
+type GeminiModel struct {
+	Name                       string   `json:"name"`
+	DisplayName                string   `json:"displayName"`
+	SupportedGenerationMethods []string `json:"supportedGenerationMethods"`
+}
+
+func (g *Gemini) Models(ctx context.Context) ([]Model, error) {
+	client, err := g.modelsClient()
+	if err != nil {
+		return nil, err
+	}
+	var modelList ModelList
+	pageToken := ""
+	for {
+		query := url.Values{}
+		query.Set("pageSize", "1000")
+		if pageToken != "" {
+			query.Set("pageToken", pageToken)
+		}
+		req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/models?%s", g.BaseURL, query.Encode()), nil)
+		if err != nil {
+			return nil, err
+		}
+		g.applyHeaders(req.Header)
+		res, err := g.do(client, req, g.setAuth)
+		if err != nil {
+			return nil, err
+		}
+		if res.StatusCode != http.StatusOK {
+			res.Body.Close()
+			return nil, fmt.Errorf("status code: %d", res.StatusCode)
+		}
+		var geminiModels GeminiModelsResponse
+		err = json.NewDecoder(res.Body).Decode(&geminiModels)
+		res.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, model := range geminiModels.Models {
+			if !slices.Contains(model.SupportedGenerationMethods, "generateContent") {
+				continue
+			}
+			modelList.Data = append(modelList.Data, Model{
+				ID:      strings.TrimPrefix(model.Name, "models/"),
+				Object:  "model",
+				OwnedBy: "google",
+			})
+		}
+		if geminiModels.NextPageToken == "" {
+			break
+		}
+		pageToken = geminiModels.NextPageToken
+	}
+	return modelList.Data, nil
+}
@@ -0,0 +1,59 @@
+package providers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestGeminiChat(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/models/gemini-2.5-flash:generateContent" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if r.Header.Get("x-goog-api-key") != "test-key" {
+			t.Errorf("missing api key header")
+		}
+		body, _ := io.ReadAll(r.Body)
+		req := gjson.ParseBytes(body)
+		if req.Get("systemInstruction.parts.0.text").String() != "be brief" {
+			t.Errorf("unexpected system instruction %s", req.Get("systemInstruction").Raw)
+		}
+		if req.Get("contents.0.role").String() != "user" || req.Get("contents.0.parts.0.text").String() != "hi" {
+			t.Errorf("unexpected contents %s", req.Get("contents").Raw)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{
+			"responseId": "resp_1",
+			"candidates": [{"content": {"role": "model", "parts": [{"text": "hello"}]}, "finishReason": "STOP"}],
+			"usageMetadata": {"promptTokenCount": 3, "candidatesTokenCount": 2, "thoughtsTokenCount": 4, "totalTokenCount": 9}
+		}`)
+	}))
+	defer server.Close()
+
+	gemini := &Gemini{BaseURL: server.URL, Keys: Keys{APIKey: "test-key"}}
+	res, err := gemini.Chat(context.Background(), server.Client(), "gemini-2.5-flash", []byte(`{
+		"model": "gemini",
+		"messages": [{"role": "system", "content": "be brief"}, {"role": "user", "content": "hi"}]
+	}`))
+	if err != nil {
+		t.Fatalf("chat: %v", err)
+	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(res.Body)
+	out := gjson.ParseBytes(body)
+
+	if got := out.Get("choices.0.message.content").String(); got != "hello" {
+		t.Errorf("unexpected content %s", got)
+	}
+	if got := out.Get("choices.0.finish_reason").String(); got != "stop" {
+		t.Errorf("unexpected finish_reason %s", got)
+	}
+	if out.Get("usage.prompt_tokens").Int() != 3 || out.Get("usage.completion_tokens").Int() != 6 || out.Get("usage.total_tokens").Int() != 9 {
+		t.Errorf("unexpected usage %s", out.Get("usage").Raw)
+	}
+}
@@ -0,0 +1,321 @@
+package providers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/atopos31/llmio/balancer"
+)
+
+const (
+	KeyStrategyRoundRobin = "round_robin"
+	KeyStrategyWeighted   = "weighted"
+)
+
+const (
+	keyRateLimitCooldown = time.Minute      // 429未返回Retry-After时的冷却时间
+	keyAuthCooldown      = 30 * time.Minute // 401/403后的禁用时间 到期后重新尝试
+)
+
+// APIKey 单个密钥 配置中可写为字符串或 {"key": "...", "weight": 2}
+type APIKey struct {
+	Key    string `json:"key"`
+	Weight int    `json:"weight"`
+}
+
+func (k *APIKey) UnmarshalJSON(data []byte) error {
+	var key string
+	if err := json.Unmarshal(data, &key); err == nil {
+		k.Key = key
+		k.Weight = 1
+		return nil
+	}
+	type plain APIKey
+	var p plain
+	if err := json.Unmarshal(data, &p); err != nil {
+		return err
+	}
+	if p.Weight <= 0 {
+		p.Weight = 1
+	}
+	*k = APIKey(p)
+	return nil
+}
+
+// Keys 提供商的密钥配置 兼容单个api_key与多个api_keys
+type Keys struct {
+	APIKey      string   `json:"api_key"`
+	APIKeys     []APIKey `json:"api_keys"`
+	KeyStrategy string   `json:"key_strategy"` // round_robin(默认) | weighted
+}
+
+// list 返回全部密钥 api_key与api_keys合并去重
+func (k *Keys) list() []APIKey {
+	keys := make([]APIKey, 0, len(k.APIKeys)+1)
+	seen := make(map[string]bool, len(k.APIKeys)+1)
+	if k.APIKey != "" {
+		keys = append(keys, APIKey{Key: k.APIKey, Weight: 1})
+		seen[k.APIKey] = true
+	}
+	for _, key := range k.APIKeys {
+		if key.Key == "" || seen[key.Key] {
+			continue
+		}
+		seen[key.Key] = true
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// First 返回第一个密钥 用于只需要单个密钥的场景
+func (k *Keys) First() string {
+	keys := k.list()
+	if len(keys) == 0 {
+		return ""
+	}
+	return keys[0].Key
+}
+
+// pickMu 保证选择密钥与记录使用在同一临界区内完成 避免并发请求选中同一个密钥
+var (
+	pickMu sync.Mutex
+	useSeq uint64 // 使用序号 由pickMu保护 序号越小表示越久未使用
+)
+
+// candidates 返回未冷却且未被排除的密钥 excluded为本次请求已失败的密钥
+// 全部密钥都在冷却且没有排除项时降级为全部密钥
+func (k *Keys) candidates(excluded map[string]bool) ([]APIKey, error) {
+	keys := k.list()
+	if len(keys) == 0 {
+		return nil, errors.New("no api key configured")
+	}
+	now := time.Now()
+	candidates := make([]APIKey, 0, len(keys))
+	for _, key := range keys {
+		if !excluded[key.Key] && !keyStateOf(key.Key).coolingDown(now) {
+			candidates = append(candidates, key)
+		}
+	}
+	if len(candidates) == 0 {
+		if len(excluded) != 0 {
+			return nil, errors.New("no available api key")
+		}
+		candidates = keys
+	}
+	return candidates, nil
+}
+
+// pick 按策略选择一个密钥并记录一次使用
+func (k *Keys) pick(excluded map[string]bool) (string, error) {
+	pickMu.Lock()
+	defer pickMu.Unlock()
+	candidates, err := k.candidates(excluded)
+	if err != nil {
+		return "", err
+	}
+
+	selected := candidates[0].Key
+	if k.KeyStrategy == KeyStrategyWeighted {
+		items := make(map[string]int, len(candidates))
+		for _, key := range candidates {
+			items[key.Key] = key.Weight
+		}
+		key, err := balancer.WeightedRandom(items)
+		if err != nil {
+			return "", err
+		}
+		selected = *key
+	} else {
+		// 轮询: 选择最久未使用的密钥
+		oldest := keyStateOf(selected).lastSeq()
+		for _, key := range candidates[1:] {
+			if used := keyStateOf(key.Key).lastSeq(); used < oldest {
+				selected, oldest = key.Key, used
+			}
+		}
+	}
+	useSeq++
+	keyStateOf(selected).use(useSeq)
+	return selected, nil
+}
+
+// do 选择密钥发送请求 密钥被拒绝(401/403/429)时仅冷却该密钥并换用下一个密钥重试
+func (k *Keys) do(client *http.Client, req *http.Request, auth func(header http.Header, key string)) (*http.Response, error) {
+	excluded := make(map[string]bool)
+	for {
+		key, err := k.pick(excluded)
+		if err != nil {
+			return nil, err
+		}
+		attempt := req
+		if len(excluded) != 0 {
+			attempt = req.Clone(req.Context())
+			if req.GetBody != nil {
+				if attempt.Body, err = req.GetBody(); err != nil {
+					return nil, err
+				}
+			}
+		}
+		auth(attempt.Header, key)
+		res, err := client.Do(attempt)
+		if err != nil {
+			return nil, err
+		}
+		if !keyStateOf(key).observe(res.StatusCode, res.Header) {
+			return res, nil
+		}
+		excluded[key] = true
+		// 没有其他可用密钥或请求体无法重放时 将错误响应交给调用方
+		if _, err := k.candidates(excluded); err != nil || (req.Body != nil && req.GetBody == nil) {
+			return res, nil
+		}
+		res.Body.Close()
+	}
+}
+
+// keyState 单个密钥的运行时状态
+type keyState struct {
+	mu             sync.Mutex
+	requests       int64
+	errors         int64
+	lastStatusCode int
+	lastUsedAt     time.Time
+	lastUseSeq     uint64
+	lastErrorAt    time.Time
+	cooldownUntil  time.Time
+	disabled       bool // 因401/403被禁用
+}
+
+// keyStates 密钥哈希 -> 状态 同一密钥被多个提供商使用时共享状态
+var keyStates sync.Map
+
+func keyID(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+func keyStateOf(key string) *keyState {
+	state, _ := keyStates.LoadOrStore(keyID(key), &keyState{})
+	return state.(*keyState)
+}
+
+func (s *keyState) coolingDown(now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return now.Before(s.cooldownUntil)
+}
+
+func (s *keyState) lastSeq() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastUseSeq
+}
+
+func (s *keyState) use(seq uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+	s.lastUseSeq = seq
+	s.lastUsedAt = time.Now()
+}
+
+// observe 记录响应状态 返回该密钥是否被拒绝 429按Retry-After冷却
+func (s *keyState) observe(statusCode int, header http.Header) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastStatusCode = statusCode
+	now := time.Now()
+	switch statusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		s.errors++
+		s.lastErrorAt = now
+		s.disabled = true
+		s.cooldownUntil = now.Add(keyAuthCooldown)
+		return true
+	case http.StatusTooManyRequests:
+		s.errors++
+		s.lastErrorAt = now
+		cooldown := parseRetryAfter(header, now)
+		if cooldown <= 0 {
+			cooldown = keyRateLimitCooldown
+		}
+		s.cooldownUntil = now.Add(cooldown)
+		return true
+	default:
+		if statusCode >= http.StatusBadRequest {
+			s.errors++
+			s.lastErrorAt = now
+		} else {
+			s.disabled = false
+		}
+		return false
+	}
+}
+
+// KeyStatus 密钥状态 供管理接口展示
+type KeyStatus struct {
+	Key            string     `json:"key"`    // 脱敏后的密钥
+	Status         string     `json:"status"` // active, cooldown, disabled
+	Weight         int        `json:"weight"`
+	Requests       int64      `json:"requests"`
+	Errors         int64      `json:"errors"`
+	LastStatusCode int        `json:"last_status_code,omitempty"`
+	LastUsedAt     *time.Time `json:"last_used_at,omitempty"`
+	LastErrorAt    *time.Time `json:"last_error_at,omitempty"`
+	CooldownUntil  *time.Time `json:"cooldown_until,omitempty"`
+}
+
+// KeyStatuses 返回提供商配置中各密钥的状态 不使用api_key的提供商类型返回空
+func KeyStatuses(providerConfig string) ([]KeyStatus, error) {
+	var keys Keys
+	if err := json.Unmarshal([]byte(providerConfig), &keys); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	list := keys.list()
+	statuses := make([]KeyStatus, 0, len(list))
+	for _, key := range list {
+		state := keyStateOf(key.Key)
+		state.mu.Lock()
+		status := KeyStatus{
+			Key:            maskKey(key.Key),
+			Status:         "active",
+			Weight:         key.Weight,
+			Requests:       state.requests,
+			Errors:         state.errors,
+			LastStatusCode: state.lastStatusCode,
+		}
+		if !state.lastUsedAt.IsZero() {
+			lastUsedAt := state.lastUsedAt
+			status.LastUsedAt = &lastUsedAt
+		}
+		if !state.lastErrorAt.IsZero() {
+			lastErrorAt := state.lastErrorAt
+			status.LastErrorAt = &lastErrorAt
+		}
+		if now.Before(state.cooldownUntil) {
+			cooldownUntil := state.cooldownUntil
+			status.CooldownUntil = &cooldownUntil
+			status.Status = "cooldown"
+			if state.disabled {
+				status.Status = "disabled"
+			}
+		}
+		state.mu.Unlock()
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// maskKey 仅保留密钥首尾少量字符
+func maskKey(key string) string {
+	if len(key) <= 8 {
+		return "****"
+	}
+	return key[:4] + "****" + key[len(key)-4:]
+}
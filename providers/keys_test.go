@@ -0,0 +1,167 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestKeysRotation(t *testing.T) {
+	var used []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Authorization")
+		used = append(used, key)
+		body, _ := io.ReadAll(r.Body)
+		if len(body) == 0 {
+			t.Errorf("empty body for %s", key)
+		}
+		if key == "Bearer rotation-revoked" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		io.WriteString(w, `{}`)
+	}))
+	defer server.Close()
+
+	var openai OpenAI
+	config := `{"base_url":"` + server.URL + `","api_keys":["rotation-key-a",{"key":"rotation-revoked","weight":2},"rotation-key-b"]}`
+	if err := json.Unmarshal([]byte(config), &openai); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	for range 4 {
+		res, err := openai.Chat(context.Background(), server.Client(), "gpt", []byte(`{"messages":[]}`))
+		if err != nil {
+			t.Fatalf("chat: %v", err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("unexpected status %d", res.StatusCode)
+		}
+	}
+
+	revoked := 0
+	counts := map[string]int{}
+	for _, key := range used {
+		counts[key]++
+		if key == "Bearer rotation-revoked" {
+			revoked++
+		}
+	}
+	if revoked != 1 {
+		t.Errorf("revoked key used %d times, want 1: %v", revoked, used)
+	}
+	if counts["Bearer rotation-key-a"] != 2 || counts["Bearer rotation-key-b"] != 2 {
+		t.Errorf("keys not rotated evenly: %v", used)
+	}
+
+	statuses, err := KeyStatuses(config)
+	if err != nil {
+		t.Fatalf("key statuses: %v", err)
+	}
+	if len(statuses) != 3 || statuses[1].Status != "disabled" || statuses[1].Errors != 1 || statuses[1].Weight != 2 {
+		t.Errorf("unexpected statuses %+v", statuses)
+	}
+	if statuses[0].Status != "active" || statuses[0].Key != "rota****ey-a" {
+		t.Errorf("unexpected status %+v", statuses[0])
+	}
+}
+
+func TestKeysConcurrentRotation(t *testing.T) {
+	var mu sync.Mutex
+	counts := map[string]int{}
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		counts[r.Header.Get("x-goog-api-key")]++
+		mu.Unlock()
+		<-release
+		io.WriteString(w, `{}`)
+	}))
+	defer server.Close()
+
+	gemini := &Gemini{BaseURL: server.URL, Keys: Keys{APIKeys: []APIKey{{Key: "concurrent-a", Weight: 1}, {Key: "concurrent-b", Weight: 1}, {Key: "concurrent-c", Weight: 1}}}}
+	var wg sync.WaitGroup
+	for range 30 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, _ := http.NewRequest("GET", server.URL, nil)
+			res, err := gemini.do(server.Client(), req, gemini.setAuth)
+			if err != nil {
+				t.Errorf("do: %v", err)
+				return
+			}
+			res.Body.Close()
+		}()
+	}
+	for {
+		mu.Lock()
+		total := counts["concurrent-a"] + counts["concurrent-b"] + counts["concurrent-c"]
+		mu.Unlock()
+		if total == 30 {
+			break
+		}
+	}
+	close(release)
+	wg.Wait()
+
+	for _, key := range []string{"concurrent-a", "concurrent-b", "concurrent-c"} {
+		if counts[key] != 10 {
+			t.Errorf("keys not spread evenly under concurrency: %v", counts)
+			break
+		}
+	}
+}
+
+func TestKeysAllRejected(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	anthropic := &Anthropic{BaseURL: server.URL, Keys: Keys{APIKeys: []APIKey{{Key: "limited-a", Weight: 1}, {Key: "limited-b", Weight: 1}}}}
+	res, err := anthropic.Chat(context.Background(), server.Client(), "claude", []byte(`{}`))
+	if err != nil {
+		t.Fatalf("chat: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("unexpected status %d", res.StatusCode)
+	}
+	// 全部密钥冷却时仍降级使用
+	if _, err := anthropic.pick(nil); err != nil {
+		t.Errorf("pick: %v", err)
+	}
+}
+
+func TestKeysRetryAfterCooldown(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "Bearer retry-after-short" {
+			w.Header().Set("Retry-After", "5")
+		}
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	openai := &OpenAI{BaseURL: server.URL, Keys: Keys{APIKeys: []APIKey{{Key: "retry-after-short", Weight: 1}, {Key: "retry-after-missing", Weight: 1}}}}
+	start := time.Now()
+	res, err := openai.Chat(context.Background(), server.Client(), "gpt", []byte(`{}`))
+	if err != nil {
+		t.Fatalf("chat: %v", err)
+	}
+	res.Body.Close()
+
+	short := keyStateOf("retry-after-short").cooldownUntil.Sub(start)
+	if short < 4*time.Second || short > 6*time.Second {
+		t.Errorf("cooldown with Retry-After = %v, want about 5s", short)
+	}
+	// 未返回Retry-After时使用默认冷却时间
+	if missing := keyStateOf("retry-after-missing").cooldownUntil.Sub(start); missing < keyRateLimitCooldown-time.Second {
+		t.Errorf("cooldown without Retry-After = %v, want %v", missing, keyRateLimitCooldown)
+	}
+}
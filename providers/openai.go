@@ -13,7 +13,15 @@
 
 type OpenAI struct {
 	BaseURL string `json:"base_url"`
-	APIKey  string `json:"api_key"`
+	Keys
+	Outbound
+	Overrides
+	NativeResponses bool `json:"responses"` // 上游是否原生支持Responses API
+}
+
+// setAuth 设置Bearer认证头
+func (o *OpenAI) setAuth(header http.Header, key string) {
+	header.Set("Authorization", fmt.Sprintf("Bearer %s", key))
 }
 
 // GetHost 获取OpenAI的主机地址
@@ -31,14 +39,58 @@ func (o *OpenAI) Chat(ctx context.Context, client *http.Client, model string, ra
 	if err != nil {
 		return nil, err
 	}
+	if body, err = o.applyBody(body); err != nil {
+		return nil, err
+	}
 	req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s/chat/completions", o.BaseURL), bytes.NewReader(body))
 	if err != nil {
 		return nil, err
 	}
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", o.APIKey))
+	o.applyHeaders(req.Header)
 
-	return client.Do(req)
+	return o.do(client, req, o.setAuth)
+}
+
+// SupportsResponses 是否直接透传Responses请求
+func (o *OpenAI) SupportsResponses() bool {
+	return o.NativeResponses
+}
+
+func (o *OpenAI) Responses(ctx context.Context, client *http.Client, model string, rawBody []byte) (*http.Response, error) {
+	body, err := sjson.SetBytes(rawBody, "model", model)
+	if err != nil {
+		return nil, err
+	}
+	if body, err = o.applyBody(body); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s/responses", o.BaseURL), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	o.applyHeaders(req.Header)
+
+	return o.do(client, req, o.setAuth)
+}
+
+func (o *OpenAI) Embeddings(ctx context.Context, client *http.Client, model string, rawBody []byte) (*http.Response, error) {
+	body, err := sjson.SetBytes(rawBody, "model", model)
+	if err != nil {
+		return nil, err
+	}
+	if body, err = o.applyBody(body); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s/embeddings", o.BaseURL), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	o.applyHeaders(req.Header)
+
+	return o.do(client, req, o.setAuth)
 }
 
 func (o *OpenAI) Models(ctx context.Context) ([]Model, error) {
@@ -46,8 +98,12 @@ func (o *OpenAI) Models(ctx context.Context) ([]Model, error) {
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", o.APIKey))
-	res, err := http.DefaultClient.Do(req)
+	o.applyHeaders(req.Header)
+	client, err := o.modelsClient()
+	if err != nil {
+		return nil, err
+	}
+	res, err := o.do(client, req, o.setAuth)
 	if err != nil {
 		return nil, err
 	}
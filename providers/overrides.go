@@ -0,0 +1,43 @@
+package providers
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/tidwall/sjson"
+)
+
+// Overrides 针对非标准上游的请求定制 嵌入各提供商配置中
+type Overrides struct {
+	ExtraHeaders  map[string]string `json:"extra_headers"`  // 附加的请求头 认证头由密钥配置决定 不可覆盖
+	BodyOverrides map[string]any    `json:"body_overrides"` // sjson路径 -> 强制写入的值
+	BodyRemovals  []string          `json:"body_removals"`  // 需要从请求体删除的sjson路径
+}
+
+// applyBody 先删除body_removals中的字段 再写入body_overrides 路径按字典序处理以保证结果稳定
+func (o *Overrides) applyBody(body []byte) ([]byte, error) {
+	var err error
+	for _, path := range o.BodyRemovals {
+		if body, err = sjson.DeleteBytes(body, path); err != nil {
+			return nil, err
+		}
+	}
+	paths := make([]string, 0, len(o.BodyOverrides))
+	for path := range o.BodyOverrides {
+		paths = append(paths, path)
+	}
+	slices.Sort(paths)
+	for _, path := range paths {
+		if body, err = sjson.SetBytes(body, path, o.BodyOverrides[path]); err != nil {
+			return nil, err
+		}
+	}
+	return body, nil
+}
+
+// applyHeaders 写入extra_headers
+func (o *Overrides) applyHeaders(header http.Header) {
+	for name, value := range o.ExtraHeaders {
+		header.Set(name, value)
+	}
+}
@@ -0,0 +1,92 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestOpenAIOverrides(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("HTTP-Referer") != "https://example.com" || r.Header.Get("OpenAI-Organization") != "org-1" {
+			t.Errorf("missing extra headers %v", r.Header)
+		}
+		if r.Header.Get("Authorization") != "Bearer test-key" {
+			t.Errorf("auth header should not be overridden: %s", r.Header.Get("Authorization"))
+		}
+		body, _ := io.ReadAll(r.Body)
+		req := gjson.ParseBytes(body)
+		if req.Get("stream_options").Exists() {
+			t.Errorf("stream_options should be removed: %s", body)
+		}
+		if req.Get("provider.order.0").String() != "groq" || req.Get("temperature").Float() != 0.3 {
+			t.Errorf("body overrides not applied: %s", body)
+		}
+		if req.Get("model").String() != "gpt-4o" {
+			t.Errorf("unexpected model %s", req.Get("model").String())
+		}
+		io.WriteString(w, `{}`)
+	}))
+	defer server.Close()
+
+	provider, err := New("openai", `{
+		"base_url": "`+server.URL+`",
+		"api_key": "test-key",
+		"extra_headers": {"HTTP-Referer": "https://example.com", "OpenAI-Organization": "org-1", "Authorization": "Bearer wrong"},
+		"body_overrides": {"provider.order": ["groq"], "temperature": 0.3},
+		"body_removals": ["stream_options"]
+	}`)
+	if err != nil {
+		t.Fatalf("new provider: %v", err)
+	}
+	res, err := provider.Chat(context.Background(), server.Client(), "gpt-4o", []byte(`{"model":"x","temperature":1,"stream_options":{"include_usage":true},"messages":[]}`))
+	if err != nil {
+		t.Fatalf("chat: %v", err)
+	}
+	res.Body.Close()
+}
+
+// TestOverridesAllEndpoints 请求体定制对Responses与Embeddings同样生效
+func TestOverridesAllEndpoints(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		req := gjson.ParseBytes(body)
+		if req.Get("user").Exists() || req.Get("provider.order.0").String() != "groq" {
+			t.Errorf("body overrides not applied for %s: %s", r.URL.Path, body)
+		}
+		io.WriteString(w, `{}`)
+	}))
+	defer server.Close()
+
+	overrides := `"body_overrides": {"provider.order": ["groq"]}, "body_removals": ["user"]`
+	openai := &OpenAI{}
+	azure := &Azure{}
+	for _, provider := range []any{openai, azure} {
+		if err := json.Unmarshal([]byte(`{"base_url": "`+server.URL+`", "api_key": "test-key", `+overrides+`}`), provider); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		name string
+		call func(ctx context.Context, client *http.Client, model string, rawBody []byte) (*http.Response, error)
+	}{
+		{"openai responses", openai.Responses},
+		{"openai embeddings", openai.Embeddings},
+		{"azure responses", azure.Responses},
+		{"azure embeddings", azure.Embeddings},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := tt.call(context.Background(), server.Client(), "model", []byte(`{"input":"hi","user":"u1"}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+		})
+	}
+}
@@ -34,6 +34,10 @@ type PooledProvider interface {
 }
 
 func New(Type, providerConfig string) (Provider, error) {
+	// 提前校验代理配置 避免请求时才发现错误
+	if _, err := proxyFunc(ProxyOf(providerConfig)); err != nil {
+		return nil, err
+	}
 	switch Type {
 	case "openai":
 		var openai OpenAI
@@ -49,6 +53,30 @@ func New(Type, providerConfig string) (Provider, error) {
 		}
 		// 返回支持连接池的包装器
 		return NewPooledProviderWrapper(&anthropic, anthropic.BaseURL, 30*time.Second), nil
+	case "azure":
+		var azure Azure
+		if err := json.Unmarshal([]byte(providerConfig), &azure); err != nil {
+			return nil, err
+		}
+		if azure.APIVersion == "" {
+			azure.APIVersion = azureDefaultAPIVersion
+		}
+		// 返回支持连接池的包装器
+		return NewPooledProviderWrapper(&azure, azure.BaseURL, 30*time.Second), nil
+	case "bedrock":
+		var bedrock Bedrock
+		if err := json.Unmarshal([]byte(providerConfig), &bedrock); err != nil {
+			return nil, err
+		}
+		// 返回支持连接池的包装器
+		return NewPooledProviderWrapper(&bedrock, bedrock.runtimeURL(), 30*time.Second), nil
+	case "gemini":
+		var gemini Gemini
+		if err := json.Unmarshal([]byte(providerConfig), &gemini); err != nil {
+			return nil, err
+		}
+		// 返回支持连接池的包装器
+		return NewPooledProviderWrapper(&gemini, gemini.BaseURL, 30*time.Second), nil
 	default:
 		return nil, errors.New("unknown provider type")
 	}
@@ -0,0 +1,74 @@
+package providers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Budget 上游返回的一类限额(请求数或token数)
+type Budget struct {
+	Limit     int64
+	Remaining int64
+	Reset     time.Time // 限额重置时间 未知时为零值
+}
+
+// RateLimit 从上游响应头中解析出的限流信息
+type RateLimit struct {
+	RetryAfter time.Duration // Retry-After 未返回时为0
+	Requests   *Budget       // 请求数限额 未返回时为nil
+	Tokens     *Budget       // token限额 未返回时为nil
+}
+
+// ParseRateLimit 解析Retry-After与限流响应头
+// 支持OpenAI的 x-ratelimit-{limit,remaining,reset}-{requests,tokens}
+// 与Anthropic的 anthropic-ratelimit-{requests,tokens}-{limit,remaining,reset}
+func ParseRateLimit(header http.Header, now time.Time) RateLimit {
+	rl := RateLimit{RetryAfter: parseRetryAfter(header, now)}
+	rl.Requests = parseBudget(header, now, "requests")
+	rl.Tokens = parseBudget(header, now, "tokens")
+	return rl
+}
+
+// parseRetryAfter 支持retry-after-ms、秒数与HTTP日期三种形式
+func parseRetryAfter(header http.Header, now time.Time) time.Duration {
+	if ms, err := strconv.ParseFloat(header.Get("retry-after-ms"), 64); err == nil && ms > 0 {
+		return time.Duration(ms * float64(time.Millisecond))
+	}
+	value := strings.TrimSpace(header.Get("Retry-After"))
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return max(time.Duration(seconds*float64(time.Second)), 0)
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(at.Sub(now), 0)
+	}
+	return 0
+}
+
+func parseBudget(header http.Header, now time.Time, kind string) *Budget {
+	// OpenAI格式 重置时间为时长(如 6m0s、20ms)
+	if remaining := header.Get("x-ratelimit-remaining-" + kind); remaining != "" {
+		budget := &Budget{}
+		budget.Remaining, _ = strconv.ParseInt(remaining, 10, 64)
+		budget.Limit, _ = strconv.ParseInt(header.Get("x-ratelimit-limit-"+kind), 10, 64)
+		if reset, err := time.ParseDuration(header.Get("x-ratelimit-reset-" + kind)); err == nil {
+			budget.Reset = now.Add(reset)
+		}
+		return budget
+	}
+	// Anthropic格式 重置时间为RFC 3339
+	if remaining := header.Get("anthropic-ratelimit-" + kind + "-remaining"); remaining != "" {
+		budget := &Budget{}
+		budget.Remaining, _ = strconv.ParseInt(remaining, 10, 64)
+		budget.Limit, _ = strconv.ParseInt(header.Get("anthropic-ratelimit-"+kind+"-limit"), 10, 64)
+		if reset, err := time.Parse(time.RFC3339, header.Get("anthropic-ratelimit-"+kind+"-reset")); err == nil {
+			budget.Reset = reset
+		}
+		return budget
+	}
+	return nil
+}
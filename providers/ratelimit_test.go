@@ -0,0 +1,50 @@
+package providers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	openai := http.Header{}
+	openai.Set("x-ratelimit-limit-requests", "60")
+	openai.Set("x-ratelimit-remaining-requests", "3")
+	openai.Set("x-ratelimit-reset-requests", "1m30s")
+	openai.Set("x-ratelimit-limit-tokens", "150000")
+	openai.Set("x-ratelimit-remaining-tokens", "149000")
+	openai.Set("x-ratelimit-reset-tokens", "20ms")
+	openai.Set("Retry-After", "2")
+	rl := ParseRateLimit(openai, now)
+	if rl.RetryAfter != 2*time.Second {
+		t.Errorf("retry after = %s", rl.RetryAfter)
+	}
+	if rl.Requests == nil || rl.Requests.Limit != 60 || rl.Requests.Remaining != 3 || !rl.Requests.Reset.Equal(now.Add(90*time.Second)) {
+		t.Errorf("unexpected requests budget %+v", rl.Requests)
+	}
+	if rl.Tokens == nil || rl.Tokens.Remaining != 149000 || !rl.Tokens.Reset.Equal(now.Add(20*time.Millisecond)) {
+		t.Errorf("unexpected tokens budget %+v", rl.Tokens)
+	}
+
+	anthropic := http.Header{}
+	anthropic.Set("anthropic-ratelimit-requests-limit", "50")
+	anthropic.Set("anthropic-ratelimit-requests-remaining", "0")
+	anthropic.Set("anthropic-ratelimit-requests-reset", "2025-01-01T00:00:30Z")
+	anthropic.Set("retry-after", now.Add(time.Minute).Format(http.TimeFormat))
+	rl = ParseRateLimit(anthropic, now)
+	if rl.RetryAfter != time.Minute {
+		t.Errorf("retry after = %s", rl.RetryAfter)
+	}
+	if rl.Requests == nil || rl.Requests.Remaining != 0 || !rl.Requests.Reset.Equal(now.Add(30*time.Second)) {
+		t.Errorf("unexpected anthropic budget %+v", rl.Requests)
+	}
+	if rl.Tokens != nil {
+		t.Errorf("unexpected tokens budget %+v", rl.Tokens)
+	}
+
+	if rl := ParseRateLimit(http.Header{}, now); rl.RetryAfter != 0 || rl.Requests != nil {
+		t.Errorf("expected empty rate limit, got %+v", rl)
+	}
+}
@@ -0,0 +1,50 @@
+package providers
+
+import (
+	"context"
+	"net/http"
+)
+
+// ResponsesProvider 原生支持OpenAI Responses API的Provider
+type ResponsesProvider interface {
+	Provider
+	// SupportsResponses 上游是否开启了Responses API(由提供商配置决定)
+	SupportsResponses() bool
+	Responses(ctx context.Context, client *http.Client, model string, rawBody []byte) (*http.Response, error)
+}
+
+// SupportsNativeResponses 判断提供商是否开启了原生Responses API
+// 依赖服务端状态的请求(如previous_response_id)只能交给这类提供商
+func SupportsNativeResponses(Type, providerConfig string) bool {
+	provider, err := New(Type, providerConfig)
+	if err != nil {
+		return false
+	}
+	_, ok := nativeResponses(provider)
+	return ok
+}
+
+// nativeResponses 若上游原生支持Responses API 返回直接透传的Provider
+func nativeResponses(provider Provider) (Provider, bool) {
+	if wrapper, ok := provider.(*PooledProviderWrapper); ok {
+		provider = wrapper.GetUnderlyingProvider()
+	}
+	responses, ok := provider.(ResponsesProvider)
+	if !ok || !responses.SupportsResponses() {
+		return nil, false
+	}
+	return &responsesPassthrough{provider: responses}, true
+}
+
+// responsesPassthrough 将Chat调用转发到上游的Responses接口
+type responsesPassthrough struct {
+	provider ResponsesProvider
+}
+
+func (p *responsesPassthrough) Chat(ctx context.Context, client *http.Client, model string, rawBody []byte) (*http.Response, error) {
+	return p.provider.Responses(ctx, client, model, rawBody)
+}
+
+func (p *responsesPassthrough) Models(ctx context.Context) ([]Model, error) {
+	return p.provider.Models(ctx)
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/atopos31/llmio/models"
+	"github.com/atopos31/llmio/providers"
+)
+
+// firstChunkSize 等待首个chunk时单次读取的上限
+const firstChunkSize = 32 * 1024
+
+// attempt 对一个模型提供商关联的一次请求尝试
+type attempt struct {
+	item              uint
+	provider          *models.Provider
+	modelWithProvider models.ModelWithProvider
+	log               models.ChatLog
+	start             time.Time
+	cancel            context.CancelFunc
+	limiter           *limiter // 已占用名额的网关侧限额
+	reserved          int64    // 在limiter中预留的token数
+
+	res        *http.Response
+	header     http.Header // 上游响应头 用于解析限流信息
+	body       io.Reader   // 成功时的响应体 包含已读取的首个chunk
+	statusCode int         // 上游返回非200时的状态码
+	err        error
+}
+
+// run 发送请求并等待响应头与首个chunk 完成后将自身发送到results
+// 成功时保持并发计数 由调用方在响应转发结束后调用finish释放
+func (a *attempt) run(ctx context.Context, chatModel providers.Provider, client *http.Client, raw []byte, results chan<- *attempt) {
+	defer func() { results <- a }()
+	inFlight.Acquire(a.item)
+	res, err := chatModel.Chat(ctx, client, a.modelWithProvider.ProviderModel, raw)
+	if err != nil {
+		a.finish()
+		a.err = err
+		return
+	}
+	a.header = res.Header
+	if res.StatusCode != http.StatusOK {
+		a.finish()
+		defer res.Body.Close()
+		byteBody, err := io.ReadAll(res.Body)
+		if err != nil {
+			slog.Error("read body error", "error", err)
+		}
+		a.statusCode = res.StatusCode
+		a.err = fmt.Errorf("status: %d, body: %s", res.StatusCode, string(byteBody))
+		return
+	}
+
+	// 以首个chunk到达作为响应就绪 流式响应的响应头往往先于内容返回
+	chunk := make([]byte, firstChunkSize)
+	n, err := res.Body.Read(chunk)
+	if err != nil && err != io.EOF {
+		a.finish()
+		res.Body.Close()
+		a.err = err
+		return
+	}
+	a.res = res
+	a.body = io.MultiReader(bytes.NewReader(chunk[:n]), res.Body)
+}
+
+// finish 请求结束 归还并发计数与限额的并发名额
+func (a *attempt) finish() {
+	inFlight.Release(a.item)
+	a.limiter.release()
+}
+
+// settleBreaker 将尝试结果计入熔断器
+// 只有连接错误、5xx、408与429归因于上游 客户端取消或请求有误等情况仅归还探测名额
+func (a *attempt) settleBreaker(requestCtx context.Context) {
+	b := breakerOf(a.item)
+	switch {
+	case a.err == nil:
+		b.record(time.Now(), false)
+	case requestCtx.Err() != nil, errors.Is(a.err, providers.ErrInvalidRequest):
+		b.release()
+	case a.statusCode == 0, a.statusCode >= http.StatusInternalServerError,
+		a.statusCode == http.StatusRequestTimeout, a.statusCode == http.StatusTooManyRequests:
+		b.record(time.Now(), true)
+	default:
+		b.release()
+	}
+}
+
+// abandon 处理对冲中落败且已被取消的尝试 记录为hedged而非错误
+func (a *attempt) abandon() {
+	breakerOf(a.item).release()
+	a.limiter.settle(a.reserved, 0)
+	if a.res != nil {
+		a.res.Body.Close()
+		a.finish()
+	}
+	log := a.log
+	log.Status = "hedged"
+	if _, err := SaveChatLog(context.Background(), log); err != nil {
+		slog.Error("save chat log error", "error", err)
+	}
+}
@@ -1,6 +1,8 @@
 package service
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 
 	"github.com/tidwall/gjson"
@@ -13,9 +15,45 @@ type before struct {
 	toolCall         bool
 	structuredOutput bool
 	image            bool
+	inputs           int    // embeddings请求的输入条数
+	nativeOnly       bool   // 依赖上游会话状态 只能由原生支持该风格的提供商处理
+	session          string // 会话键 用于粘性路由 为空表示无法识别会话
+	promptTokens     int    // 估算的输入token数
+	maxTokens        int    // 请求的最大输出token数 0表示未指定
 	raw              []byte
 }
 
+// sessionKey 提取会话键: 优先使用请求中的用户标识
+// 否则使用系统提示词与首条用户消息(含之前的消息)的哈希 多轮对话中这部分保持不变
+func sessionKey(data []byte, userPaths []string, systemPath, messagesPath string) string {
+	for _, path := range userPaths {
+		if user := gjson.GetBytes(data, path).String(); user != "" {
+			return "user:" + user
+		}
+	}
+	h := sha256.New()
+	written := false
+	if system := gjson.GetBytes(data, systemPath); system.Exists() {
+		h.Write([]byte(system.Raw))
+		written = true
+	}
+	messages := gjson.GetBytes(data, messagesPath)
+	if messages.IsArray() {
+		messages.ForEach(func(_, value gjson.Result) bool {
+			h.Write([]byte(value.Raw))
+			written = true
+			return value.Get("role").String() != "user"
+		})
+	} else if messages.Exists() {
+		h.Write([]byte(messages.Raw))
+		written = true
+	}
+	if !written {
+		return ""
+	}
+	return "prompt:" + hex.EncodeToString(h.Sum(nil)[:16])
+}
+
 type Beforer func(data []byte) (*before, error)
 
 func BeforerOpenAI(data []byte) (*before, error) {
@@ -43,6 +81,11 @@ func BeforerOpenAI(data []byte) (*before, error) {
 	if gjson.GetBytes(data, "response_format").Exists() {
 		structuredOutput = true
 	}
+	// max_tokens已被废弃 新客户端使用max_completion_tokens
+	maxTokens := gjson.GetBytes(data, "max_completion_tokens")
+	if !maxTokens.Exists() {
+		maxTokens = gjson.GetBytes(data, "max_tokens")
+	}
 	var image bool
 	gjson.GetBytes(data, "messages").ForEach(func(_, value gjson.Result) bool {
 		if image {
@@ -65,6 +108,9 @@ func BeforerOpenAI(data []byte) (*before, error) {
 		toolCall:         toolCall,
 		structuredOutput: structuredOutput,
 		image:            image,
+		session:          sessionKey(data, []string{"prompt_cache_key", "user"}, "", "messages"),
+		promptTokens:     estimateTokens(data, "messages", "tools"),
+		maxTokens:        int(maxTokens.Int()),
 		raw:              data,
 	}, nil
 }
@@ -102,6 +148,87 @@ func BeforerAnthropic(data []byte) (*before, error) {
 		toolCall:         toolCall,
 		structuredOutput: toolCall,
 		image:            image,
+		session:          sessionKey(data, []string{"metadata.user_id"}, "system", "messages"),
+		promptTokens:     estimateTokens(data, "system", "messages", "tools"),
+		maxTokens:        int(gjson.GetBytes(data, "max_tokens").Int()),
+		raw:              data,
+	}, nil
+}
+
+func BeforerResponses(data []byte) (*before, error) {
+	model := gjson.GetBytes(data, "model").String()
+	if model == "" {
+		return nil, errors.New("model is empty")
+	}
+	stream := gjson.GetBytes(data, "stream").Bool()
+	var toolCall bool
+	tools := gjson.GetBytes(data, "tools")
+	if tools.Exists() && len(tools.Array()) != 0 {
+		toolCall = true
+	}
+	// previous_response_id依赖上游保存的会话 无法经Chat Completions转换
+	nativeOnly := gjson.GetBytes(data, "previous_response_id").String() != ""
+	var structuredOutput bool
+	switch gjson.GetBytes(data, "text.format.type").String() {
+	case "json_schema", "json_object":
+		structuredOutput = true
+	}
+	var image bool
+	// input可以是字符串或输入项数组
+	gjson.GetBytes(data, "input").ForEach(func(_, value gjson.Result) bool {
+		if image {
+			return false
+		}
+		value.Get("content").ForEach(func(_, value gjson.Result) bool {
+			if value.Get("type").String() == "input_image" {
+				image = true
+				return false
+			}
+			return true
+		})
+		return true
+	})
+	return &before{
+		model:            model,
+		stream:           stream,
+		toolCall:         toolCall,
+		structuredOutput: structuredOutput,
+		image:            image,
+		nativeOnly:       nativeOnly,
+		session:          sessionKey(data, []string{"prompt_cache_key", "user"}, "instructions", "input"),
+		promptTokens:     estimateTokens(data, "instructions", "input", "tools"),
+		maxTokens:        int(gjson.GetBytes(data, "max_output_tokens").Int()),
 		raw:              data,
 	}, nil
 }
+
+func BeforerEmbeddings(data []byte) (*before, error) {
+	model := gjson.GetBytes(data, "model").String()
+	if model == "" {
+		return nil, errors.New("model is empty")
+	}
+	// input可以是字符串、字符串数组、token数组或token数组的数组
+	input := gjson.GetBytes(data, "input")
+	var inputs int
+	switch {
+	case !input.Exists():
+		return nil, errors.New("input is empty")
+	case input.IsArray():
+		items := input.Array()
+		inputs = len(items)
+		// 单个token数组视为一条输入
+		if inputs != 0 && items[0].Type == gjson.Number {
+			inputs = 1
+		}
+	default:
+		inputs = 1
+	}
+	if inputs == 0 {
+		return nil, errors.New("input is empty")
+	}
+	return &before{
+		model:  model,
+		inputs: inputs,
+		raw:    data,
+	}, nil
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSessionKey(t *testing.T) {
+	firstTurn := []byte(`{"model":"m","messages":[{"role":"system","content":"be brief"},{"role":"user","content":"hi"}]}`)
+	secondTurn := []byte(`{"model":"m","messages":[{"role":"system","content":"be brief"},{"role":"user","content":"hi"},{"role":"assistant","content":"hello"},{"role":"user","content":"more"}]}`)
+	other := []byte(`{"model":"m","messages":[{"role":"system","content":"be brief"},{"role":"user","content":"bye"}]}`)
+
+	first, err := BeforerOpenAI(firstTurn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _ := BeforerOpenAI(secondTurn)
+	third, _ := BeforerOpenAI(other)
+	if first.session == "" || first.session != second.session {
+		t.Errorf("turns of one conversation got different sessions %q %q", first.session, second.session)
+	}
+	if first.session == third.session {
+		t.Errorf("different conversations share session %q", first.session)
+	}
+
+	withUser, _ := BeforerOpenAI([]byte(`{"model":"m","user":"alice","messages":[{"role":"user","content":"hi"}]}`))
+	if withUser.session != "user:alice" {
+		t.Errorf("unexpected session %q", withUser.session)
+	}
+	anthropic, _ := BeforerAnthropic([]byte(`{"model":"m","metadata":{"user_id":"bob"},"messages":[]}`))
+	if anthropic.session != "user:bob" {
+		t.Errorf("unexpected anthropic session %q", anthropic.session)
+	}
+	embeddings, _ := BeforerEmbeddings([]byte(`{"model":"m","input":"hi"}`))
+	if embeddings.session != "" {
+		t.Errorf("embeddings should not be sticky: %q", embeddings.session)
+	}
+}
+
+func TestEstimateTokens(t *testing.T) {
+	openai, err := BeforerOpenAI([]byte(`{"model":"m","max_tokens":100,"messages":[{"role":"user","content":"` + strings.Repeat("abcd", 500) + `"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if openai.promptTokens < 500 || openai.promptTokens > 520 || openai.maxTokens != 100 {
+		t.Errorf("openai prompt_tokens = %d max_tokens = %d", openai.promptTokens, openai.maxTokens)
+	}
+	// max_completion_tokens优先
+	completion, _ := BeforerOpenAI([]byte(`{"model":"m","max_tokens":100,"max_completion_tokens":200,"messages":[]}`))
+	if completion.maxTokens != 200 {
+		t.Errorf("max_completion_tokens = %d", completion.maxTokens)
+	}
+	// 中文按每字一个token计 图片按固定开销计 不按base64长度计
+	anthropic, _ := BeforerAnthropic([]byte(`{"model":"m","max_tokens":50,"system":"你好世界","messages":[{"role":"user","content":[{"type":"image","source":{"type":"base64","media_type":"image/png","data":"` + strings.Repeat("A", 100000) + `"}}]}]}`))
+	if anthropic.promptTokens < 4+imageTokens || anthropic.promptTokens > 4+imageTokens+20 || anthropic.maxTokens != 50 {
+		t.Errorf("anthropic prompt_tokens = %d max_tokens = %d", anthropic.promptTokens, anthropic.maxTokens)
+	}
+	responses, _ := BeforerResponses([]byte(`{"model":"m","max_output_tokens":10,"input":"hello world!"}`))
+	if responses.promptTokens != 3 || responses.maxTokens != 10 {
+		t.Errorf("responses prompt_tokens = %d max_tokens = %d", responses.promptTokens, responses.maxTokens)
+	}
+}
+
+func TestFits(t *testing.T) {
+	cases := []struct {
+		prompt, max, window, maxOutput int
+		want                           bool
+	}{
+		{1000, 500, 0, 0, true},
+		{1000, 500, 1500, 0, true},
+		{1000, 501, 1500, 0, false},
+		{2000, 0, 1500, 0, false},
+		{10, 5000, 0, 4096, false},
+		{10, 4096, 8192, 4096, true},
+	}
+	for _, c := range cases {
+		if got := fits(c.prompt, c.max, c.window, c.maxOutput); got != c.want {
+			t.Errorf("fits(%d, %d, %d, %d) = %v, want %v", c.prompt, c.max, c.window, c.maxOutput, got, c.want)
+		}
+	}
+}
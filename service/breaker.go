@@ -0,0 +1,184 @@
+package service
+
+import (
+	"sync"
+	"time"
+)
+
+// 熔断器状态
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half_open"
+)
+
+const (
+	breakerWindow        = time.Minute     // 统计失败率的滑动窗口
+	breakerBuckets       = 6               // 滑动窗口的分桶数
+	breakerMinRequests   = 5               // 窗口内请求数达到该值才判断失败率
+	breakerFailureRate   = 0.5             // 失败率达到该值时熔断
+	breakerBaseCooldown  = 5 * time.Second // 首次熔断的冷却时间
+	breakerMaxCooldown   = 5 * time.Minute // 冷却时间上限 连续熔断时指数增长
+	breakerHalfOpenProbe = 3               // 半开状态允许的探测请求数 全部成功后关闭
+)
+
+// breakerBucket 滑动窗口中的一个分桶
+type breakerBucket struct {
+	start    time.Time
+	requests int
+	failures int
+}
+
+// breaker 单个模型提供商关联的熔断器
+type breaker struct {
+	mu        sync.Mutex
+	state     string
+	buckets   [breakerBuckets]breakerBucket
+	trips     int // 连续熔断次数 决定冷却时间 关闭后清零
+	openUntil time.Time
+	probes    int // 半开状态已放行的探测请求数
+	successes int // 半开状态成功的探测请求数
+}
+
+// breakers 模型提供商关联ID -> 熔断器
+var breakers sync.Map
+
+func breakerOf(id uint) *breaker {
+	b, _ := breakers.LoadOrStore(id, &breaker{state: BreakerClosed})
+	return b.(*breaker)
+}
+
+// available 关联当前是否可能放行请求 不占用探测名额 用于筛选候选项
+func (b *breaker) available(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		return !now.Before(b.openUntil)
+	case BreakerHalfOpen:
+		return b.probes < breakerHalfOpenProbe
+	default:
+		return true
+	}
+}
+
+// begin 请求发出前调用 冷却结束时进入半开状态并占用一个探测名额 返回是否放行
+func (b *breaker) begin(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerOpen {
+		if now.Before(b.openUntil) {
+			return false
+		}
+		b.state = BreakerHalfOpen
+		b.probes = 0
+		b.successes = 0
+	}
+	if b.state == BreakerHalfOpen {
+		if b.probes >= breakerHalfOpenProbe {
+			return false
+		}
+		b.probes++
+	}
+	return true
+}
+
+// record 记录一次请求结果
+func (b *breaker) record(now time.Time, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerHalfOpen:
+		if failed {
+			b.trip(now)
+			return
+		}
+		b.successes++
+		if b.successes >= breakerHalfOpenProbe {
+			b.state = BreakerClosed
+			b.trips = 0
+			b.buckets = [breakerBuckets]breakerBucket{}
+		}
+	case BreakerClosed:
+		bucket := b.bucket(now)
+		bucket.requests++
+		if failed {
+			bucket.failures++
+		}
+		requests, failures := b.window(now)
+		if requests >= breakerMinRequests && float64(failures)/float64(requests) >= breakerFailureRate {
+			b.trip(now)
+		}
+	}
+}
+
+// release 请求被取消或结果与上游无关(如客户端请求有误)时调用 只归还半开状态的探测名额
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerHalfOpen && b.probes > 0 {
+		b.probes--
+	}
+}
+
+// trip 进入熔断 冷却时间随连续熔断次数指数增长
+func (b *breaker) trip(now time.Time) {
+	cooldown := breakerBaseCooldown << min(b.trips, 16)
+	b.trips++
+	b.state = BreakerOpen
+	b.openUntil = now.Add(min(cooldown, breakerMaxCooldown))
+	b.buckets = [breakerBuckets]breakerBucket{}
+}
+
+// bucket 返回当前时间所在的分桶 过期的分桶被重置
+func (b *breaker) bucket(now time.Time) *breakerBucket {
+	size := breakerWindow / breakerBuckets
+	start := now.Truncate(size)
+	bucket := &b.buckets[(start.UnixNano()/int64(size))%breakerBuckets]
+	if !bucket.start.Equal(start) {
+		*bucket = breakerBucket{start: start}
+	}
+	return bucket
+}
+
+// window 统计滑动窗口内的请求数与失败数
+func (b *breaker) window(now time.Time) (requests, failures int) {
+	for _, bucket := range b.buckets {
+		if now.Sub(bucket.start) < breakerWindow {
+			requests += bucket.requests
+			failures += bucket.failures
+		}
+	}
+	return requests, failures
+}
+
+// BreakerStatus 熔断器状态 供管理接口展示
+type BreakerStatus struct {
+	State       string     `json:"state"`
+	Requests    int        `json:"requests"`     // 滑动窗口内的请求数
+	FailureRate float64    `json:"failure_rate"` // 滑动窗口内的失败率
+	Trips       int        `json:"trips"`        // 连续熔断次数
+	OpenUntil   *time.Time `json:"open_until,omitempty"`
+}
+
+// GetBreakerStatus 返回关联的熔断器状态 尚未处理过请求的关联视为关闭
+func GetBreakerStatus(id uint) BreakerStatus {
+	b := breakerOf(id)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	requests, failures := b.window(now)
+	status := BreakerStatus{
+		State:    b.state,
+		Requests: requests,
+		Trips:    b.trips,
+	}
+	if requests > 0 {
+		status.FailureRate = float64(failures) / float64(requests)
+	}
+	if b.state == BreakerOpen {
+		openUntil := b.openUntil
+		status.OpenUntil = &openUntil
+	}
+	return status
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	b := &breaker{state: BreakerClosed}
+	now := time.Now()
+
+	// 样本不足时不熔断
+	for range breakerMinRequests - 1 {
+		b.begin(now)
+		b.record(now, true)
+	}
+	if b.state != BreakerClosed {
+		t.Fatalf("tripped before min requests: %s", b.state)
+	}
+	b.begin(now)
+	b.record(now, true)
+	if b.state != BreakerOpen || b.begin(now) || b.available(now) {
+		t.Fatalf("expected open breaker, got %s", b.state)
+	}
+
+	// 冷却结束后进入半开 只放行有限的探测请求
+	now = now.Add(breakerBaseCooldown)
+	if !b.available(now) {
+		t.Fatal("breaker should be available after cooldown")
+	}
+	for range breakerHalfOpenProbe {
+		if !b.begin(now) {
+			t.Fatal("probe rejected")
+		}
+	}
+	if b.state != BreakerHalfOpen || b.begin(now) {
+		t.Fatalf("extra probe allowed in %s", b.state)
+	}
+
+	// 探测失败 以翻倍的冷却时间重新熔断
+	b.record(now, true)
+	if b.state != BreakerOpen || !b.openUntil.Equal(now.Add(2*breakerBaseCooldown)) {
+		t.Fatalf("expected backoff, state %s open until %s", b.state, b.openUntil.Sub(now))
+	}
+
+	// 探测全部成功后关闭
+	now = now.Add(2 * breakerBaseCooldown)
+	for range breakerHalfOpenProbe {
+		b.begin(now)
+	}
+	b.release() // 被取消的探测不计入结果
+	if !b.begin(now) {
+		t.Fatal("released probe slot not reusable")
+	}
+	for range breakerHalfOpenProbe {
+		b.record(now, false)
+	}
+	if b.state != BreakerClosed || b.trips != 0 {
+		t.Fatalf("expected closed breaker, got %s trips %d", b.state, b.trips)
+	}
+
+	// 窗口外的失败不再计入
+	for range breakerMinRequests - 1 {
+		b.record(now, true)
+	}
+	now = now.Add(breakerWindow)
+	b.record(now, true)
+	if b.state != BreakerClosed {
+		t.Fatalf("stale failures tripped breaker")
+	}
+}
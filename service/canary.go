@@ -0,0 +1,265 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"time"
+
+	"github.com/atopos31/llmio/balancer"
+	"github.com/atopos31/llmio/models"
+	"gorm.io/gorm"
+)
+
+// canaryCheckInterval 检查灰度关联表现的间隔
+const canaryCheckInterval = time.Minute
+
+const (
+	CanaryStarted    = "started"
+	CanaryPromoted   = "promoted"
+	CanaryRolledBack = "rolled_back"
+)
+
+// canaryPercent 灰度关联当前的放量比例 从起始比例线性升至100
+func canaryPercent(mp models.ModelWithProvider, now time.Time) float64 {
+	if !mp.Canary || mp.CanaryStartedAt == nil {
+		return 100
+	}
+	start := float64(min(max(mp.CanaryPercent, 1), 100))
+	if mp.CanaryRampMinutes <= 0 {
+		return start
+	}
+	progress := now.Sub(*mp.CanaryStartedAt).Minutes() / float64(mp.CanaryRampMinutes)
+	return min(100, start+(100-start)*max(0, progress))
+}
+
+// canaryStrategy 先按放量比例在灰度关联与其他关联之间抽样 再在选中的一组内运行模型配置的策略
+// 灰度组被选中的概率为 Σ灰度权重×放量比例 / (Σ灰度权重×放量比例 + Σ其他权重×100)
+// 在策略之前分组 不按权重选择的策略(如最便宜、最低延迟)同样遵守放量计划
+type canaryStrategy struct {
+	inner        balancer.Strategy[uint]
+	associations map[uint]models.ModelWithProvider
+	now          time.Time
+	roll         func() float64 // [0,1)之间的抽样值
+}
+
+// withCanary 模型存在灰度关联时在strategy外包装放量抽样 否则原样返回
+// roll为空时随机抽样
+func withCanary(strategy balancer.Strategy[uint], associations map[uint]models.ModelWithProvider, now time.Time, roll func() float64) balancer.Strategy[uint] {
+	if roll == nil {
+		roll = rand.Float64
+	}
+	for _, mp := range associations {
+		if mp.Canary {
+			return canaryStrategy{inner: strategy, associations: associations, now: now, roll: roll}
+		}
+	}
+	return strategy
+}
+
+// sessionRoll 由会话键决定的固定抽样值 粘性路由的会话总是落在灰度或其他关联的同一侧
+// 放量比例升高时只有部分会话从其他关联迁移到灰度关联
+func sessionRoll(session string) func() float64 {
+	sum := sha256.Sum256([]byte(session))
+	u := float64(binary.BigEndian.Uint64(sum[:8])>>11) / (1 << 53)
+	return func() float64 { return u }
+}
+
+func (s canaryStrategy) Select(items map[uint]int) (uint, error) {
+	canary := make(map[uint]int)
+	stable := make(map[uint]int)
+	var canaryShare, stableShare float64
+	for id, weight := range items {
+		if s.associations[id].Canary {
+			canary[id] = weight
+			canaryShare += float64(max(weight, 0)) * canaryPercent(s.associations[id], s.now)
+		} else {
+			stable[id] = weight
+			stableShare += float64(max(weight, 0)) * 100
+		}
+	}
+	// 只剩一组时不再抽样
+	if len(canary) == 0 || len(stable) == 0 || canaryShare+stableShare == 0 {
+		return s.inner.Select(items)
+	}
+	if s.roll()*(canaryShare+stableShare) < canaryShare {
+		return s.inner.Select(canary)
+	}
+	return s.inner.Select(stable)
+}
+
+// canaryStat 一组关联在灰度期间的表现
+type canaryStat struct {
+	Requests  int64
+	Errors    int64
+	TTFTSum   float64 // 成功请求的首字时间之和(纳秒)
+	TTFTCount int64
+}
+
+func (s canaryStat) errorRate() float64 {
+	if s.Requests == 0 {
+		return 0
+	}
+	return float64(s.Errors) / float64(s.Requests)
+}
+
+// avgTTFT 成功请求的平均首字时间(纳秒) 没有样本时为0
+func (s canaryStat) avgTTFT() float64 {
+	if s.TTFTCount == 0 {
+		return 0
+	}
+	return s.TTFTSum / float64(s.TTFTCount)
+}
+
+// canaryVerdict 比较灰度关联与同模型其他关联的表现 超出阈值时返回回滚原因
+// 任意一方样本不足时不做判断
+func canaryVerdict(config models.SystemConfig, canary, peers canaryStat) string {
+	minSamples := int64(max(config.CanaryMinSamples, 1))
+	if canary.Requests < minSamples || peers.Requests < minSamples {
+		return ""
+	}
+	if config.CanaryMaxErrorRateDelta > 0 && canary.errorRate()-peers.errorRate() > config.CanaryMaxErrorRateDelta {
+		return fmt.Sprintf("error rate %.3f exceeds peers %.3f by more than %.3f", canary.errorRate(), peers.errorRate(), config.CanaryMaxErrorRateDelta)
+	}
+	if config.CanaryMaxTTFTRatio > 0 && canary.avgTTFT() > 0 && peers.avgTTFT() > 0 && canary.avgTTFT() > peers.avgTTFT()*config.CanaryMaxTTFTRatio {
+		return fmt.Sprintf("avg ttft %s exceeds %.1fx peers %s", time.Duration(canary.avgTTFT()).Round(time.Millisecond), config.CanaryMaxTTFTRatio, time.Duration(peers.avgTTFT()).Round(time.Millisecond))
+	}
+	return ""
+}
+
+// canaryStats 统计模型自since以来灰度关联与其他关联的请求日志 不含对冲中落败的尝试
+func canaryStats(ctx context.Context, model, providerName, providerModel string, since time.Time) (canary, peers canaryStat, err error) {
+	var rows []struct {
+		ProviderName  string
+		ProviderModel string
+		Requests      int64
+		Errors        int64
+		TTFTSum       float64
+		TTFTCount     int64
+	}
+	err = models.DB.WithContext(ctx).Model(&models.ChatLog{}).
+		Select(`provider_name, provider_model, COUNT(*) as requests,
+			SUM(CASE WHEN status = 'error' THEN 1 ELSE 0 END) as errors,
+			COALESCE(SUM(CASE WHEN status = 'success' AND first_chunk_time > 0 THEN first_chunk_time END), 0) as ttft_sum,
+			SUM(CASE WHEN status = 'success' AND first_chunk_time > 0 THEN 1 ELSE 0 END) as ttft_count`).
+		Where("name = ? AND created_at > ? AND status <> ?", model, since, "hedged").
+		Group("provider_name, provider_model").
+		Scan(&rows).Error
+	if err != nil {
+		return canary, peers, err
+	}
+	for _, row := range rows {
+		stat := &peers
+		if row.ProviderName == providerName && row.ProviderModel == providerModel {
+			stat = &canary
+		}
+		stat.Requests += row.Requests
+		stat.Errors += row.Errors
+		stat.TTFTSum += row.TTFTSum
+		stat.TTFTCount += row.TTFTCount
+	}
+	return canary, peers, nil
+}
+
+// RecordCanaryEvent 记录灰度事件
+func RecordCanaryEvent(ctx context.Context, event models.CanaryEvent) error {
+	return gorm.G[models.CanaryEvent](models.DB).Create(ctx, &event)
+}
+
+// CheckCanaries 检查所有灰度关联 放量到期的转正 表现明显差于其他关联的权重置0并结束灰度
+func CheckCanaries(ctx context.Context, now time.Time) error {
+	config, err := GetSystemConfig(ctx)
+	if err != nil {
+		return err
+	}
+	canaries, err := gorm.G[models.ModelWithProvider](models.DB).Where("canary = ?", true).Find(ctx)
+	if err != nil {
+		return err
+	}
+	changed := false
+	for _, mp := range canaries {
+		if mp.CanaryStartedAt == nil {
+			continue
+		}
+		event, err := checkCanary(ctx, config, mp, now)
+		if err != nil {
+			slog.Warn("check canary error", "model_provider_id", mp.ID, "error", err)
+			continue
+		}
+		if event == nil {
+			continue
+		}
+		// 回滚时权重需写入0 Updates(struct)会忽略零值
+		updates := map[string]any{"canary": false}
+		if event.Event == CanaryRolledBack {
+			updates["weight"] = 0
+		}
+		if err := models.DB.WithContext(ctx).Model(&models.ModelWithProvider{}).Where("id = ?", mp.ID).Updates(updates).Error; err != nil {
+			slog.Error("end canary error", "model_provider_id", mp.ID, "error", err)
+			continue
+		}
+		if err := RecordCanaryEvent(ctx, *event); err != nil {
+			slog.Error("save canary event error", "error", err)
+		}
+		slog.Warn("canary ended", "model_provider_id", mp.ID, "event", event.Event, "reason", event.Reason)
+		changed = true
+	}
+	if changed {
+		configCache.ClearCache()
+	}
+	return nil
+}
+
+// checkCanary 判断单个灰度关联是否需要结束 不需要时返回nil
+func checkCanary(ctx context.Context, config models.SystemConfig, mp models.ModelWithProvider, now time.Time) (*models.CanaryEvent, error) {
+	model, err := gorm.G[models.Model](models.DB).Where("id = ?", mp.ModelID).First(ctx)
+	if err != nil {
+		return nil, err
+	}
+	provider, err := gorm.G[models.Provider](models.DB).Where("id = ?", mp.ProviderID).First(ctx)
+	if err != nil {
+		return nil, err
+	}
+	canary, peers, err := canaryStats(ctx, model.Name, provider.Name, mp.ProviderModel, *mp.CanaryStartedAt)
+	if err != nil {
+		return nil, err
+	}
+	event := &models.CanaryEvent{
+		ModelWithProviderID: mp.ID,
+		Requests:            canary.Requests,
+		ErrorRate:           canary.errorRate(),
+		AvgTTFT:             canary.avgTTFT() / float64(time.Millisecond),
+		PeerRequests:        peers.Requests,
+		PeerErrorRate:       peers.errorRate(),
+		PeerAvgTTFT:         peers.avgTTFT() / float64(time.Millisecond),
+	}
+	if reason := canaryVerdict(config, canary, peers); reason != "" {
+		event.Event = CanaryRolledBack
+		event.Reason = reason
+		return event, nil
+	}
+	if canaryPercent(mp, now) >= 100 {
+		event.Event = CanaryPromoted
+		return event, nil
+	}
+	return nil, nil
+}
+
+// RunCanaryMonitor 定期检查灰度关联 直到ctx结束
+func RunCanaryMonitor(ctx context.Context) {
+	ticker := time.NewTicker(canaryCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := CheckCanaries(ctx, now); err != nil {
+				slog.Warn("check canaries error", "error", err)
+			}
+		}
+	}
+}
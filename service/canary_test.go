@@ -0,0 +1,201 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/atopos31/llmio/balancer"
+	"github.com/atopos31/llmio/models"
+	"gorm.io/gorm"
+)
+
+func TestCanaryPercent(t *testing.T) {
+	now := time.Now()
+	started := now.Add(-30 * time.Minute)
+	mp := models.ModelWithProvider{Weight: 1, Canary: true, CanaryStartedAt: &started, CanaryPercent: 10, CanaryRampMinutes: 60}
+	// 一半的放量时间过去后 比例为10+(100-10)*0.5=55
+	if got := canaryPercent(mp, now); got != 55 {
+		t.Fatalf("percent = %v", got)
+	}
+	if got := canaryPercent(mp, started); got != 10 {
+		t.Fatalf("percent at start = %v", got)
+	}
+	if got := canaryPercent(mp, now.Add(time.Hour)); got != 100 {
+		t.Fatalf("percent after ramp = %v", got)
+	}
+}
+
+func TestCanaryStrategy(t *testing.T) {
+	now := time.Now()
+	associations := map[uint]models.ModelWithProvider{
+		1: {Weight: 1},
+		2: {Weight: 1, Canary: true, CanaryStartedAt: &now, CanaryPercent: 10, CanaryRampMinutes: 60},
+	}
+	latency := balancer.NewLatency[uint](latencyAlpha)
+	latency.Observe(1, time.Second)
+	tests := []struct {
+		name  string
+		inner balancer.Strategy[uint]
+	}{
+		// 灰度关联最便宜 或没有延迟样本而得分最低 不分组时会拿到全部流量
+		{"cheapest", balancer.Cheapest[uint]{Cost: func(key uint) float64 { return map[uint]float64{1: 2, 2: 1}[key] }}},
+		{"lowest latency", balancer.LowestLatency[uint]{Latency: latency}},
+		{"weighted random", balancer.WeightedRandomStrategy[uint]{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 均匀抽样1000次 灰度组的份额为1*10/(1*10+1*100)
+			var i int
+			strategy := canaryStrategy{inner: tt.inner, associations: associations, now: now, roll: func() float64 {
+				i++
+				return float64(i-1) / 1000
+			}}
+			var canaryCalls int
+			for range 1000 {
+				item, err := strategy.Select(map[uint]int{1: 1, 2: 1})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if item == 2 {
+					canaryCalls++
+				}
+			}
+			if canaryCalls != 91 {
+				t.Fatalf("canary calls = %d, want 91", canaryCalls)
+			}
+		})
+	}
+
+	// 只剩灰度关联时直接交给策略
+	strategy := withCanary(balancer.WeightedRandomStrategy[uint]{}, associations, now, nil)
+	if item, err := strategy.Select(map[uint]int{2: 1}); err != nil || item != 2 {
+		t.Fatalf("item = %d, err = %v", item, err)
+	}
+	delete(associations, 2)
+	if _, ok := withCanary(balancer.WeightedRandomStrategy[uint]{}, associations, now, nil).(canaryStrategy); ok {
+		t.Fatal("strategy wrapped without canary")
+	}
+}
+
+func TestCanaryStickySessions(t *testing.T) {
+	now := time.Now()
+	associations := map[uint]models.ModelWithProvider{
+		1: {Weight: 1},
+		2: {Weight: 1},
+		3: {Weight: 1, Canary: true, CanaryStartedAt: &now, CanaryPercent: 10, CanaryRampMinutes: 60},
+	}
+	// 粘性会话同样按放量比例分到灰度关联 且重复请求总是选中同一关联
+	var canaryCalls int
+	for i := range 1000 {
+		session := fmt.Sprintf("session-%d", i)
+		strategy := withCanary(balancer.ConsistentHash[uint]{Key: session}, associations, now, sessionRoll(session))
+		first, err := strategy.Select(map[uint]int{1: 1, 2: 1, 3: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for range 3 {
+			if item, _ := strategy.Select(map[uint]int{1: 1, 2: 1, 3: 1}); item != first {
+				t.Fatalf("session %s moved from %d to %d", session, first, item)
+			}
+		}
+		if first == 3 {
+			canaryCalls++
+		}
+	}
+	// 灰度组的份额为1*10/(1*10+2*100)≈48/1000
+	if canaryCalls < 20 || canaryCalls > 80 {
+		t.Fatalf("canary sessions = %d", canaryCalls)
+	}
+}
+
+func TestCanaryVerdict(t *testing.T) {
+	config := models.DefaultSystemConfig()
+	peers := canaryStat{Requests: 100, Errors: 2, TTFTSum: float64(98 * 100 * time.Millisecond), TTFTCount: 98}
+
+	tests := []struct {
+		name     string
+		canary   canaryStat
+		rollback bool
+	}{
+		{"healthy", canaryStat{Requests: 20, Errors: 1, TTFTSum: float64(19 * 150 * time.Millisecond), TTFTCount: 19}, false},
+		{"few samples", canaryStat{Requests: 10, Errors: 10}, false},
+		{"error rate", canaryStat{Requests: 20, Errors: 5, TTFTSum: float64(15 * 100 * time.Millisecond), TTFTCount: 15}, true},
+		{"ttft", canaryStat{Requests: 20, TTFTSum: float64(20 * 300 * time.Millisecond), TTFTCount: 20}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if reason := canaryVerdict(config, tt.canary, peers); (reason != "") != tt.rollback {
+				t.Fatalf("reason = %q, want rollback %v", reason, tt.rollback)
+			}
+		})
+	}
+}
+
+func TestCheckCanaries(t *testing.T) {
+	initChatTest(t)
+	ctx := t.Context()
+	addChatModel(t, models.Model{Name: "canary"}, "http://stable", "http://canary", "http://ramped")
+
+	associations, err := gorm.G[models.ModelWithProvider](models.DB).Order("id").Find(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	started := now.Add(-10 * time.Minute)
+	for _, mp := range associations[1:] {
+		if err := models.DB.Model(&models.ModelWithProvider{}).Where("id = ?", mp.ID).Updates(map[string]any{
+			"canary":              true,
+			"canary_started_at":   started,
+			"canary_percent":      10,
+			"canary_ramp_minutes": 10,
+		}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 第二个关联错误率明显高于其他关联 第三个表现正常且放量到期
+	logs := make([]models.ChatLog, 0, 60)
+	for i := range 20 {
+		logs = append(logs, models.ChatLog{Name: "canary", ProviderName: "canary-0", ProviderModel: "canary-0-upstream", Status: "success", FirstChunkTime: 100 * time.Millisecond})
+		status := "success"
+		if i%2 == 0 {
+			status = "error"
+		}
+		logs = append(logs, models.ChatLog{Name: "canary", ProviderName: "canary-1", ProviderModel: "canary-1-upstream", Status: status, FirstChunkTime: 100 * time.Millisecond})
+		logs = append(logs, models.ChatLog{Name: "canary", ProviderName: "canary-2", ProviderModel: "canary-2-upstream", Status: "success", FirstChunkTime: 100 * time.Millisecond})
+	}
+	if err := gorm.G[models.ChatLog](models.DB).CreateInBatches(ctx, &logs, 100); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CheckCanaries(ctx, now); err != nil {
+		t.Fatal(err)
+	}
+
+	rolledBack, err := gorm.G[models.ModelWithProvider](models.DB).Where("id = ?", associations[1].ID).First(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rolledBack.Canary || rolledBack.Weight != 0 {
+		t.Fatalf("rolled back association = canary %v weight %d", rolledBack.Canary, rolledBack.Weight)
+	}
+	promoted, err := gorm.G[models.ModelWithProvider](models.DB).Where("id = ?", associations[2].ID).First(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if promoted.Canary || promoted.Weight != 1 {
+		t.Fatalf("promoted association = canary %v weight %d", promoted.Canary, promoted.Weight)
+	}
+
+	events, err := gorm.G[models.CanaryEvent](models.DB).Order("model_with_provider_id").Find(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].Event != CanaryRolledBack || events[0].Reason == "" || events[1].Event != CanaryPromoted {
+		t.Fatalf("events = %+v", events)
+	}
+	if events[0].Requests != 20 || events[0].PeerRequests != 40 || events[0].ErrorRate != 0.5 {
+		t.Fatalf("rollback event stats = %+v", events[0])
+	}
+}
@@ -6,7 +6,7 @@
 	"fmt"
 	"io"
 	"log/slog"
-	"net/http"
+	"maps"
 	"slices"
 	"time"
 
@@ -14,17 +14,22 @@
 	"github.com/atopos31/llmio/models"
 	"github.com/atopos31/llmio/providers"
 	"github.com/gin-gonic/gin"
+	"github.com/tidwall/sjson"
 	"gorm.io/gorm"
 )
 
 // 全局配置缓存实例，默认TTL为5分钟
 var configCache = NewConfigCache(5 * time.Minute)
 
+// sessionHeader 客户端指定会话键的请求头 优先于从请求体中识别的会话
+const sessionHeader = "X-Session-ID"
+
 func BalanceChat(c *gin.Context, style string, Beforer Beforer, processer Processer) error {
 	return BalanceChatWithExclusions(c, style, Beforer, processer, nil)
 }
 
 // BalanceChatWithExclusions 支持排除特定提供商的负载均衡
+// 模型的提供商全部失败时 按模型配置的回退模型顺序继续尝试
 func BalanceChatWithExclusions(c *gin.Context, style string, Beforer Beforer, processer Processer, excludedProviderIDs []uint) error {
 	proxyStart := time.Now()
 	rawData, err := io.ReadAll(c.Request.Body)
@@ -34,20 +39,69 @@ func BalanceChatWithExclusions(c *gin.Context, style string, Beforer Beforer, pr
 	ctx := c.Request.Context()
 	before, err := Beforer(rawData)
 	if err != nil {
-		return err
+		return fmt.Errorf("%w: %v", providers.ErrInvalidRequest, err)
 	}
 
 	llmProvidersWithLimit, err := ProvidersBymodelsName(ctx, before.model)
 	if err != nil {
 		return err
 	}
+
+	slog.Info("request", "model", before.model, "stream", before.stream, "tool_call", before.toolCall, "structured_output", before.structuredOutput, "image", before.image, "inputs", before.inputs, "prompt_tokens", before.promptTokens, "max_tokens", before.maxTokens)
+
+	shadow(style, before, llmProvidersWithLimit, processer)
+
+	requested := before.model
+	err = balanceModel(c, style, before, llmProvidersWithLimit, processer, excludedProviderIDs, proxyStart, "")
+	for _, fallback := range llmProvidersWithLimit.Fallbacks {
+		var exhausted *exhaustedError
+		if !errors.As(err, &exhausted) {
+			return err
+		}
+		if fallback == requested {
+			continue
+		}
+		slog.Warn("model providers exhausted, falling back", "model", requested, "fallback", fallback, "error", err)
+		fallbackWithLimit, fallbackErr := ProvidersBymodelsName(ctx, fallback)
+		if fallbackErr != nil {
+			slog.Warn("fallback model unavailable", "fallback", fallback, "error", fallbackErr)
+			continue
+		}
+		// 改写请求中的模型名称 协议风格由各提供商的转换器处理
+		raw, setErr := sjson.SetBytes(before.raw, "model", fallback)
+		if setErr != nil {
+			return setErr
+		}
+		fallbackBefore := *before
+		fallbackBefore.model = fallback
+		fallbackBefore.raw = raw
+		err = balanceModel(c, style, &fallbackBefore, fallbackWithLimit, processer, excludedProviderIDs, proxyStart, requested)
+	}
+	return err
+}
+
+// exhaustedError 当前模型的提供商均不可用 可以回退到下一个模型
+type exhaustedError struct {
+	err error
+}
+
+func (e *exhaustedError) Error() string { return e.err.Error() }
+
+func (e *exhaustedError) Unwrap() error { return e.err }
+
+func exhausted(err error) error {
+	return &exhaustedError{err: err}
+}
+
+// balanceModel 在一个模型的提供商之间负载均衡并转发响应
+// fallbackFrom 不为空时表示由该模型回退而来 会写入响应头与日志
+func balanceModel(c *gin.Context, style string, before *before, llmProvidersWithLimit *ProvidersWithlimit, processer Processer, excludedProviderIDs []uint, proxyStart time.Time, fallbackFrom string) error {
+	ctx := c.Request.Context()
 	// 所有模型提供商关联
 	llmproviders := llmProvidersWithLimit.Providers
 
-	slog.Info("request", "model", before.model, "stream", before.stream, "tool_call", before.toolCall, "structured_output", before.structuredOutput, "image", before.image)
-
 	if len(llmproviders) == 0 {
-		return fmt.Errorf("no provider found for models %s", before.model)
+		return exhausted(fmt.Errorf("no provider found for models %s", before.model))
 	}
 
 	// 预分配切片容量
@@ -78,22 +132,56 @@ func BalanceChatWithExclusions(c *gin.Context, style string, Beforer Beforer, pr
 		queryProviderIds = providerIds
 	}
 	
-	provideritems, err := gorm.G[models.Provider](models.DB).Where("id IN ?", queryProviderIds).Where("type = ?", style).Find(ctx)
+	provideritems, err := gorm.G[models.Provider](models.DB).Where("id IN ?", queryProviderIds).Find(ctx)
 	if err != nil {
 		return err
 	}
-	if len(provideritems) == 0 {
-		return fmt.Errorf("no %s provider found for %s", style, before.model)
-	}
 
 	// 构建providerID到provider的映射，避免重复查找
+	// 仅保留能直接或经协议转换服务当前请求风格的提供商
 	providerMap := make(map[uint]*models.Provider, len(provideritems))
 	for i := range provideritems {
 		provider := &provideritems[i]
+		if !providers.Supports(provider.Type, style) {
+			continue
+		}
+		if before.nativeOnly && !providers.SupportsNativeResponses(provider.Type, provider.Config) {
+			continue
+		}
 		providerMap[provider.ID] = provider
 	}
+	if len(providerMap) == 0 {
+		if before.nativeOnly {
+			return fmt.Errorf("%w: previous_response_id requires a provider with native responses API for %s", providers.ErrInvalidRequest, before.model)
+		}
+		return exhausted(fmt.Errorf("no %s provider found for %s", style, before.model))
+	}
+	// 按路由规则限制可用的提供商
+	rules, err := MatchRules(ctx, ruleInputOf(c, before))
+	if err != nil {
+		return err
+	}
+	if len(rules.Matched) != 0 {
+		slog.Info("routing rules matched", "model", before.model, "rules", rules.Matched)
+		for id, provider := range providerMap {
+			if !rules.allows(*provider) {
+				delete(providerMap, id)
+			}
+		}
+		if len(providerMap) == 0 {
+			return exhausted(fmt.Errorf("no provider allowed by routing rules for %s", before.model))
+		}
+	}
 
 	items := make(map[uint]int)
+	saturated := make(map[uint]int)
+	associations := make(map[uint]models.ModelWithProvider, len(llmproviders))
+	providerOf := make(map[uint]uint, len(llmproviders))
+	candidates := make(map[uint]routingCandidate, len(llmproviders))
+	priorityOf := make(map[uint]int, len(llmproviders))
+	costOf := make(map[uint]float64, len(llmproviders))
+	// 放行时按输入token加最大输出token预留TPM 请求结束后按实际用量结算
+	reserve := int64(before.promptTokens + before.maxTokens)
 	for _, modelWithProvider := range llmproviders {
 		// 过滤是否开启工具调用
 		if modelWithProvider.ToolCall != nil && before.toolCall && !*modelWithProvider.ToolCall {
@@ -107,17 +195,73 @@ func BalanceChatWithExclusions(c *gin.Context, style string, Beforer Beforer, pr
 		if modelWithProvider.Image != nil && before.image && !*modelWithProvider.Image {
 			continue
 		}
-		provider := providerMap[modelWithProvider.ProviderID]
+		// 过滤上下文窗口或最大输出容纳不下的关联
+		if !fits(before.promptTokens, before.maxTokens, modelWithProvider.ContextWindow, modelWithProvider.MaxOutputTokens) {
+			slog.Warn("context window exceeded", "model", before.model, "provider_model", modelWithProvider.ProviderModel, "prompt_tokens", before.promptTokens, "max_tokens", before.maxTokens)
+			continue
+		}
 		// 过滤提供商类型
-		if provider == nil || provider.Type != style {
+		if providerMap[modelWithProvider.ProviderID] == nil {
+			continue
+		}
+		// 过滤熔断中的关联
+		if !breakerOf(modelWithProvider.ID).available(time.Now()) {
+			slog.Warn("circuit breaker open", "model", before.model, "provider_model", modelWithProvider.ProviderModel, "model_provider_id", modelWithProvider.ID)
+			continue
+		}
+		// 过滤上游限流冷却中的关联
+		if rateLimitOf(modelWithProvider.ID).coolingDown(time.Now()) {
+			slog.Warn("rate limit cooldown", "model", before.model, "provider_model", modelWithProvider.ProviderModel, "model_provider_id", modelWithProvider.ID)
+			continue
+		}
+		associations[modelWithProvider.ID] = modelWithProvider
+		providerOf[modelWithProvider.ID] = modelWithProvider.ProviderID
+		priorityOf[modelWithProvider.ID] = modelWithProvider.Priority
+		costOf[modelWithProvider.ID] = estimateCost(modelWithProvider, before.promptTokens, before.maxTokens)
+		candidates[modelWithProvider.ID] = routingCandidate{
+			providerName:  providerMap[modelWithProvider.ProviderID].Name,
+			providerModel: modelWithProvider.ProviderModel,
+		}
+		// 已达到网关侧限额的关联暂不参与 全部达到限额时排队等待
+		if limiterOf(modelWithProvider).saturated(time.Now(), reserve) {
+			slog.Warn("model provider saturated", "model", before.model, "provider_model", modelWithProvider.ProviderModel, "model_provider_id", modelWithProvider.ID)
+			saturated[modelWithProvider.ID] = modelWithProvider.Weight
 			continue
 		}
 		items[modelWithProvider.ID] = modelWithProvider.Weight
 	}
 
+	queued := len(items) == 0 && len(saturated) > 0
+	if queued {
+		items = saturated
+	}
 	if len(items) == 0 {
-		return errors.New("no provider with tool_call or structured_output or image found for models " + before.model)
+		return exhausted(errors.New("no available provider with tool_call or structured_output or image or enough context window found for models " + before.model))
+	}
+	// 按近期成功率与响应时间调整权重
+	items = applySmartRouting(ctx, items, candidates)
+	// 避开剩余限额即将耗尽的上游
+	items = applyRateLimitHeadroom(items)
+	strategyName := llmProvidersWithLimit.Strategy
+	if rules.Strategy != "" {
+		strategyName = rules.Strategy
+	}
+	strategy := strategyFor(ctx, before.model, strategyName, providerOf, costOf)
+	var roll func() float64
+	if llmProvidersWithLimit.Sticky {
+		// 同一会话按一致性哈希固定关联 失败被移除后落到哈希上的下一个关联
+		// 粘性路由覆盖规则与模型配置的策略 规则对提供商的过滤已在此前生效
+		session := c.GetHeader(sessionHeader)
+		if session == "" {
+			session = before.session
+		}
+		if session != "" {
+			strategy = balancer.ConsistentHash[uint]{Key: session}
+			roll = sessionRoll(session)
+		}
 	}
+	// 灰度中的关联按放量计划先抽样 再在选中的一组内运行策略 粘性会话按会话键抽样
+	strategy = withCanary(strategy, associations, time.Now(), roll)
 	// 收集重试过程中的err日志
 	retryErrLog := make(chan models.ChatLog, llmProvidersWithLimit.MaxRetry)
 	defer close(retryErrLog)
@@ -130,117 +274,243 @@ func BalanceChatWithExclusions(c *gin.Context, style string, Beforer Beforer, pr
 		}
 	}()
 
-	for retry := 0; retry < llmProvidersWithLimit.MaxRetry; retry++ {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		case <-time.After(time.Second * time.Duration(llmProvidersWithLimit.TimeOut)):
-			return errors.New("retry time out !")
-		default:
-			// 加权负载均衡
-			item, err := balancer.WeightedRandom(items)
-			if err != nil {
-				return err
-			}
-			modelWithProviderIndex := slices.IndexFunc(llmproviders, func(mp models.ModelWithProvider) bool {
-				return mp.ID == *item
-			})
-			modelWithProvider := llmproviders[modelWithProviderIndex]
+	// launch 选中关联后发起一次尝试 提供商配置有误时返回错误
+	launch := func(item uint, retry, priority int, limits *limiter, results chan<- *attempt) (*attempt, error) {
+		modelWithProvider := associations[item]
 
-			provider := providerMap[modelWithProvider.ProviderID]
+		provider := providerMap[modelWithProvider.ProviderID]
 
-			chatModel, err := providers.New(style, provider.Config)
-			if err != nil {
-				return err
-			}
+		chatModel, err := providers.NewWithStyle(style, provider.Type, provider.Config)
+		if err != nil {
+			return nil, err
+		}
+		client, err := providers.GetClientWithProxy(time.Second*time.Duration(llmProvidersWithLimit.TimeOut)/3, providers.ProxyOf(provider.Config))
+		if err != nil {
+			return nil, err
+		}
 
-			slog.Info("using provider", "provider", provider.Name, "model", modelWithProvider.ProviderModel)
+		slog.Info("using provider", "provider", provider.Name, "model", modelWithProvider.ProviderModel, "priority", priority)
 
-			log := models.ChatLog{
+		attemptCtx, cancel := context.WithCancel(ctx)
+		a := &attempt{
+			item:              item,
+			provider:          provider,
+			modelWithProvider: modelWithProvider,
+			log: models.ChatLog{
 				Name:          before.model,
 				ProviderModel: modelWithProvider.ProviderModel,
 				ProviderName:  provider.Name,
 				Status:        "success",
 				Style:         style,
 				Retry:         retry,
+				Priority:      priority,
+				FallbackFrom:  fallbackFrom,
 				ProxyTime:     time.Since(proxyStart),
-			}
-			reqStart := time.Now()
-			client := providers.GetClient(time.Second * time.Duration(llmProvidersWithLimit.TimeOut) / 3)
-			res, err := chatModel.Chat(ctx, client, modelWithProvider.ProviderModel, before.raw)
+			},
+			start:    time.Now(),
+			cancel:   cancel,
+			limiter:  limits,
+			reserved: reserve,
+		}
+		go a.run(attemptCtx, chatModel, client, before.raw, results)
+		return a, nil
+	}
+
+	// pick 只在优先级最高且仍有可用成员的一层中 按模型配置的策略负载均衡
+	// 已达到限额或熔断器拒绝放行的关联从candidates中移除后重新选择
+	pick := func(candidates map[uint]int) (uint, int, *limiter, error) {
+		for {
+			tier, priority := topTier(candidates, priorityOf)
+			item, err := strategy.Select(tier)
 			if err != nil {
-				retryErrLog <- log.WithError(err)
-				// 请求失败 移除待选
-				delete(items, *item)
-				
-				// 更新健康检查状态
-				go updateProviderHealthOnError(context.Background(), provider.ID, err.Error(), 0)
-				continue
+				return 0, 0, nil, err
+			}
+			limits := limiterOf(associations[item])
+			if limits.acquire(time.Now(), reserve) {
+				if breakerOf(item).begin(time.Now()) {
+					return item, priority, limits, nil
+				}
+				limits.settle(reserve, 0)
+				limits.release()
+			}
+			delete(candidates, item)
+		}
+	}
+
+	// 所有关联均已达到限额时排队 轮到时占用的名额用于首次尝试
+	var admitted *admission
+	if queued {
+		admitted, err = waitInQueue(c, llmProvidersWithLimit.TimeOut, func() (admission, bool) {
+			item, priority, limits, err := pick(maps.Clone(items))
+			return admission{item, priority, limits}, err == nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	hedgeDelay := time.Duration(llmProvidersWithLimit.HedgeDelay) * time.Millisecond
+	for retry := 0; retry < llmProvidersWithLimit.MaxRetry; retry++ {
+		select {
+		case <-ctx.Done():
+			if admitted != nil {
+				admitted.limits.release()
+				breakerOf(admitted.item).release()
 			}
-			// 注意：连接池中的client会在使用后自动管理，这里使用的是缓存的client，不需要手动归还
+			return ctx.Err()
+		case <-time.After(time.Second * time.Duration(llmProvidersWithLimit.TimeOut)):
+			return exhausted(errors.New("retry time out !"))
+		default:
+		}
 
-			if res.StatusCode != http.StatusOK {
-				byteBody, err := io.ReadAll(res.Body)
+		var item uint
+		var priority int
+		var limits *limiter
+		if admitted != nil {
+			item, priority, limits = admitted.item, admitted.priority, admitted.limits
+			admitted = nil
+		} else if item, priority, limits, err = pick(items); err != nil {
+			return exhausted(err)
+		}
+		results := make(chan *attempt, 2)
+		first, err := launch(item, retry, priority, limits, results)
+		if err != nil {
+			limits.settle(reserve, 0)
+			limits.release()
+			breakerOf(item).release()
+			return err
+		}
+		pending := []*attempt{first}
+
+		// 开启对冲时 首个尝试在延迟内没有返回首个chunk 则向另一个关联发起第二个尝试
+		var hedge <-chan time.Time
+		var timer *time.Timer
+		if hedgeDelay > 0 {
+			timer = time.NewTimer(hedgeDelay)
+			hedge = timer.C
+		}
+
+		var winner *attempt
+		for winner == nil && len(pending) > 0 {
+			select {
+			case <-hedge:
+				hedge = nil
+				rest := maps.Clone(items)
+				for _, a := range pending {
+					delete(rest, a.item)
+				}
+				hedgeItem, hedgePriority, hedgeLimits, err := pick(rest)
 				if err != nil {
-					slog.Error("read body error", "error", err)
+					// 没有其他可用的关联
+					continue
 				}
-				errorMsg := fmt.Sprintf("status: %d, body: %s", res.StatusCode, string(byteBody))
-				retryErrLog <- log.WithError(fmt.Errorf(errorMsg))
-
-				// 更新健康检查状态
-				go updateProviderHealthOnError(context.Background(), provider.ID, errorMsg, res.StatusCode)
-
-				if res.StatusCode == http.StatusTooManyRequests {
-					// 达到RPM限制 降低权重
-					items[*item] -= items[*item] / 3
-				} else {
-					// 非RPM限制 移除待选
-					delete(items, *item)
+				second, err := launch(hedgeItem, retry, hedgePriority, hedgeLimits, results)
+				if err != nil {
+					hedgeLimits.settle(reserve, 0)
+					hedgeLimits.release()
+					breakerOf(hedgeItem).release()
+					slog.Error("launch hedged attempt error", "error", err)
+					continue
 				}
-				res.Body.Close()
-				continue
-			}
-			defer res.Body.Close()
+				slog.Info("hedging request", "model", before.model, "delay", hedgeDelay)
+				pending = append(pending, second)
+			case a := <-results:
+				pending = slices.DeleteFunc(pending, func(p *attempt) bool { return p == a })
+				a.settleBreaker(ctx)
+				rateLimitOf(a.item).observe(time.Now(), a.statusCode, a.header)
+				if a.err == nil {
+					winner = a
+					continue
+				}
+				a.cancel()
+				a.limiter.settle(a.reserved, 0)
+				if errors.Is(a.err, providers.ErrInvalidRequest) {
+					// 客户端请求有误 换用其他提供商也无法成功
+					for _, p := range pending {
+						p.cancel()
+					}
+					go func(n int) {
+						for range n {
+							(<-results).abandon()
+						}
+					}(len(pending))
+					return a.err
+				}
+				retryErrLog <- a.log.WithError(a.err)
 
-			// 成功请求，更新健康状态和使用统计
-			go updateProviderHealthOnSuccess(context.Background(), provider.ID)
+				// 更新健康检查状态
+				go updateProviderHealthOnError(context.Background(), a.provider.ID, a.err.Error(), a.statusCode)
 
-			logId, err := SaveChatLog(ctx, log)
-			if err != nil {
-				return err
+				// 请求失败 移除待选 限流的关联已按Retry-After或重置时间进入冷却
+				delete(items, a.item)
 			}
-			
-			// 更新使用统计
-			go UpdateProviderUsageStats(context.Background(), models.DB, provider.ID, log)
-
-			pr, pw := io.Pipe()
-			tee := io.TeeReader(res.Body, pw)
-
-			// 与客户端并行处理响应数据流 同时记录日志
-			go func(ctx context.Context) {
-				defer pr.Close()
-				processer(ctx, pr, before.stream, logId, reqStart)
-			}(context.Background())
-			// 转发给客户端
-			if before.stream {
-				c.Header("Content-Type", "text/event-stream")
-				c.Header("Cache-Control", "no-cache")
-			} else {
-				c.Header("Content-Type", "application/json")
-			}
-			c.Writer.Flush()
-			if _, err := io.Copy(c.Writer, tee); err != nil {
-				pw.CloseWithError(err)
-				return err
+		}
+		// 每轮结束时停止对冲计时器 不在循环内defer以免堆积到请求结束
+		if timer != nil {
+			timer.Stop()
+		}
+		if winner == nil {
+			continue
+		}
+		// 取消对冲中落败的尝试
+		for _, p := range pending {
+			p.cancel()
+		}
+		go func(n int) {
+			for range n {
+				(<-results).abandon()
 			}
+		}(len(pending))
 
-			pw.Close()
+		defer winner.cancel()
+		defer winner.res.Body.Close()
+		defer winner.finish()
+		latency.Observe(winner.item, time.Since(winner.start))
 
-			return nil
+		// 成功请求，更新健康状态和使用统计
+		go updateProviderHealthOnSuccess(context.Background(), winner.provider.ID)
+
+		log := winner.log
+		logId, err := SaveChatLog(ctx, log)
+		if err != nil {
+			return err
+		}
+
+		// 更新使用统计
+		go UpdateProviderUsageStats(context.Background(), models.DB, winner.provider.ID, log)
+
+		pr, pw := io.Pipe()
+		tee := io.TeeReader(winner.body, pw)
+
+		// 与客户端并行处理响应数据流 同时记录日志
+		go func(ctx context.Context) {
+			defer pr.Close()
+			usage := processer(ctx, pr, before.stream, logId, winner.start).Usage
+			winner.limiter.settle(winner.reserved, usage.TotalTokens)
+			saveCost(ctx, logId, winner.modelWithProvider, usage)
+		}(context.Background())
+		// 转发给客户端
+		if fallbackFrom != "" {
+			c.Header("X-Fallback-Model", before.model)
+		}
+		if before.stream {
+			c.Header("Content-Type", "text/event-stream")
+			c.Header("Cache-Control", "no-cache")
+		} else {
+			c.Header("Content-Type", "application/json")
 		}
+		c.Writer.Flush()
+		if _, err := io.Copy(c.Writer, tee); err != nil {
+			pw.CloseWithError(err)
+			return err
+		}
+
+		pw.Close()
+
+		return nil
 	}
 
-	return errors.New("maximum retry attempts reached !")
+	return exhausted(errors.New("maximum retry attempts reached !"))
 }
 
 func SaveChatLog(ctx context.Context, log models.ChatLog) (uint, error) {
@@ -352,9 +622,16 @@ func updateProviderHealthOnSuccess(ctx context.Context, providerID uint) {
 }
 
 type ProvidersWithlimit struct {
-	Providers []models.ModelWithProvider
-	MaxRetry  int
-	TimeOut   int
+	Providers           []models.ModelWithProvider
+	MaxRetry            int
+	TimeOut             int
+	Strategy            string   // 负载均衡策略
+	Fallbacks           []string // 提供商全部失败时依次尝试的模型
+	HedgeDelay          int      // 对冲延迟 单位毫秒 0表示不对冲
+	Sticky              bool     // 是否按会话粘性路由
+	ShadowProviderID    uint     // 影子流量目标提供商 0表示不开启
+	ShadowProviderModel string   // 影子流量目标的模型名称
+	ShadowPercent       int      // 复制到影子目标的请求百分比
 }
 
 // ProvidersBymodelsName 获取模型对应的提供商列表，支持缓存
@@ -381,8 +658,15 @@ func ProvidersBymodelsNameDirect(ctx context.Context, modelsName string) (*Provi
 		return nil, errors.New("not provider for model " + modelsName)
 	}
 	return &ProvidersWithlimit{
-		Providers: llmproviders,
-		MaxRetry:  llmmodels.MaxRetry,
-		TimeOut:   llmmodels.TimeOut,
+		Providers:           llmproviders,
+		MaxRetry:            llmmodels.MaxRetry,
+		TimeOut:             llmmodels.TimeOut,
+		Strategy:            llmmodels.Strategy,
+		Fallbacks:           llmmodels.Fallbacks,
+		HedgeDelay:          llmmodels.HedgeDelay,
+		Sticky:              llmmodels.Sticky,
+		ShadowProviderID:    llmmodels.ShadowProviderID,
+		ShadowProviderModel: llmmodels.ShadowProviderModel,
+		ShadowPercent:       llmmodels.ShadowPercent,
 	}, nil
 }
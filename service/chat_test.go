@@ -0,0 +1,381 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/atopos31/llmio/models"
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"gorm.io/gorm"
+)
+
+// initChatTest 初始化临时数据库与配置缓存
+func initChatTest(t *testing.T) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	models.Init(filepath.Join(t.TempDir(), "chat.db"))
+	configCache = NewConfigCache(5 * time.Minute)
+	breakers.Clear()
+	rateLimits.Clear()
+	limiters.Clear()
+	systemConfigMu.Lock()
+	systemConfig = nil
+	systemConfigMu.Unlock()
+	InvalidateRules()
+}
+
+// addChatModel 创建模型 并为每个上游创建一个OpenAI提供商及关联 关联的优先级按顺序递减
+func addChatModel(t *testing.T, model models.Model, urls ...string) {
+	t.Helper()
+	ctx := t.Context()
+	if model.MaxRetry == 0 {
+		model.MaxRetry = 3
+	}
+	if model.TimeOut == 0 {
+		model.TimeOut = 30
+	}
+	if err := gorm.G[models.Model](models.DB).Create(ctx, &model); err != nil {
+		t.Fatal(err)
+	}
+	for i, url := range urls {
+		name := fmt.Sprintf("%s-%d", model.Name, i)
+		provider := models.Provider{Name: name, Type: "openai", Config: `{"base_url":"` + url + `","api_key":"sk-test"}`}
+		if err := gorm.G[models.Provider](models.DB).Create(ctx, &provider); err != nil {
+			t.Fatal(err)
+		}
+		association := models.ModelWithProvider{ModelID: model.ID, ProviderID: provider.ID, ProviderModel: name + "-upstream", Weight: 1, Priority: len(urls) - i}
+		if err := gorm.G[models.ModelWithProvider](models.DB).Create(ctx, &association); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// serve 启动测试上游 测试结束时关闭
+func serve(t *testing.T, handler http.HandlerFunc) string {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+// replyWith 返回内容为content的聊天补全响应 usage为空时不带用量
+func replyWith(content, usage string) http.HandlerFunc {
+	body := `{"choices":[{"message":{"content":"` + content + `"}}]`
+	if usage != "" {
+		body += `,"usage":` + usage
+	}
+	body += "}"
+	return func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, body)
+	}
+}
+
+// eventually 轮询直到cond成立 用于等待异步写入的日志与统计
+func eventually(t *testing.T, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); !cond(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met before deadline")
+		}
+	}
+}
+
+// chatSender 向场景中的模型发送聊天请求 body为空时发送一条hi消息
+type chatSender func(body string, header http.Header) *httptest.ResponseRecorder
+
+// chatCase 一个BalanceChat场景 upstreams依次创建为model的关联 优先级依次递减
+type chatCase struct {
+	name      string
+	model     models.Model
+	upstreams []http.HandlerFunc
+	setup     func(t *testing.T) // 可选 调整关联或创建其他模型与提供商
+	run       func(t *testing.T, send chatSender)
+}
+
+func TestBalanceChat(t *testing.T) {
+	var servedModel, shadowModel string
+	var limitedCalls, smallCalls, expensiveCalls int
+	received := make(chan struct{}, 2)
+	unblock := make(chan struct{})
+
+	cases := []chatCase{
+		{
+			name:  "fallback",
+			model: models.Model{Name: "primary", Fallbacks: []string{"missing", "backup"}},
+			upstreams: []http.HandlerFunc{func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusInternalServerError)
+			}},
+			setup: func(t *testing.T) {
+				addChatModel(t, models.Model{Name: "backup"}, serve(t, func(w http.ResponseWriter, r *http.Request) {
+					body, _ := io.ReadAll(r.Body)
+					servedModel = gjson.GetBytes(body, "model").String()
+					io.WriteString(w, `{"choices":[{"message":{"content":"ok"}}]}`)
+				}))
+			},
+			run: func(t *testing.T, send chatSender) {
+				w := send("", nil)
+				if got := w.Header().Get("X-Fallback-Model"); got != "backup" {
+					t.Errorf("X-Fallback-Model = %q, want backup", got)
+				}
+				if servedModel != "backup-0-upstream" || !strings.Contains(w.Body.String(), "ok") {
+					t.Errorf("upstream model = %q, body %s", servedModel, w.Body.String())
+				}
+				log, err := gorm.G[models.ChatLog](models.DB).Where("status = ?", "success").First(t.Context())
+				if err != nil {
+					t.Fatal(err)
+				}
+				if log.Name != "backup" || log.FallbackFrom != "primary" {
+					t.Errorf("unexpected log name=%q fallback_from=%q", log.Name, log.FallbackFrom)
+				}
+			},
+		},
+		{
+			// 慢上游优先级更高 总是首先被选中
+			name:  "hedge",
+			model: models.Model{Name: "hedged", HedgeDelay: 50},
+			upstreams: []http.HandlerFunc{func(w http.ResponseWriter, r *http.Request) {
+				// 读完请求体后服务端才能感知连接关闭
+				io.ReadAll(r.Body)
+				select {
+				case <-r.Context().Done():
+				case <-time.After(5 * time.Second):
+					io.WriteString(w, `{"choices":[{"message":{"content":"slow"}}]}`)
+				}
+			}, replyWith("fast", "")},
+			run: func(t *testing.T, send chatSender) {
+				start := time.Now()
+				if w := send("", nil); !strings.Contains(w.Body.String(), "fast") {
+					t.Errorf("unexpected body %s", w.Body.String())
+				}
+				if elapsed := time.Since(start); elapsed > 2*time.Second {
+					t.Errorf("hedge did not cut latency: %s", elapsed)
+				}
+				var logs []models.ChatLog
+				eventually(t, func() bool {
+					logs, _ = gorm.G[models.ChatLog](models.DB).Order("provider_name").Find(t.Context())
+					return len(logs) == 2
+				})
+				if logs[0].ProviderName != "hedged-0" || logs[0].Status != "hedged" || logs[0].Error != "" {
+					t.Errorf("unexpected loser log %+v", logs[0])
+				}
+				if logs[1].ProviderName != "hedged-1" || logs[1].Status != "success" {
+					t.Errorf("unexpected winner log %+v", logs[1])
+				}
+			},
+		},
+		{
+			// 被限流的上游优先级更高
+			name:  "rate limit cooldown",
+			model: models.Model{Name: "limited"},
+			upstreams: []http.HandlerFunc{func(w http.ResponseWriter, r *http.Request) {
+				limitedCalls++
+				w.Header().Set("Retry-After", "60")
+				w.WriteHeader(http.StatusTooManyRequests)
+			}, replyWith("ok", "")},
+			run: func(t *testing.T, send chatSender) {
+				for range 3 {
+					if w := send("", nil); !strings.Contains(w.Body.String(), "ok") {
+						t.Fatalf("unexpected body %s", w.Body.String())
+					}
+				}
+				// Retry-After期间不再请求被限流的上游
+				if limitedCalls != 1 {
+					t.Errorf("rate limited upstream called %d times, want 1", limitedCalls)
+				}
+			},
+		},
+		{
+			name:  "queue",
+			model: models.Model{Name: "queued"},
+			upstreams: []http.HandlerFunc{func(w http.ResponseWriter, r *http.Request) {
+				io.ReadAll(r.Body)
+				received <- struct{}{}
+				<-unblock
+				io.WriteString(w, `{"choices":[{"message":{"content":"ok"}}]}`)
+			}},
+			setup: func(t *testing.T) {
+				if err := models.DB.Model(&models.ModelWithProvider{}).Where("1 = 1").Update("max_concurrency", 1).Error; err != nil {
+					t.Fatal(err)
+				}
+			},
+			run: func(t *testing.T, send chatSender) {
+				done := make(chan struct{}, 2)
+				go func() { send("", nil); done <- struct{}{} }()
+				<-received
+				// 唯一的关联并发已满 第二个请求排队等待
+				go func() { send("", nil); done <- struct{}{} }()
+				eventually(t, func() bool { return GetQueueStats(t.Context()).Length == 1 })
+				close(unblock)
+				<-done
+				<-done
+				if stats := GetQueueStats(t.Context()); stats.Length != 0 || stats.Admitted == 0 {
+					t.Errorf("unexpected queue stats %+v", stats)
+				}
+			},
+		},
+		{
+			// 小上下文的关联优先级更高
+			name:  "context window",
+			model: models.Model{Name: "long"},
+			upstreams: []http.HandlerFunc{func(w http.ResponseWriter, r *http.Request) {
+				smallCalls++
+				w.WriteHeader(http.StatusBadRequest)
+			}, replyWith("ok", "")},
+			setup: func(t *testing.T) {
+				if err := models.DB.Model(&models.ModelWithProvider{}).Where("provider_model = ?", "long-0-upstream").Update("context_window", 1000).Error; err != nil {
+					t.Fatal(err)
+				}
+			},
+			run: func(t *testing.T, send chatSender) {
+				w := send(`{"model":"long","max_tokens":100,"messages":[{"role":"user","content":"`+strings.Repeat("word ", 1000)+`"}]}`, nil)
+				if !strings.Contains(w.Body.String(), "ok") || smallCalls != 0 {
+					t.Fatalf("unexpected body %s, small context calls %d", w.Body.String(), smallCalls)
+				}
+			},
+		},
+		{
+			name:  "cheapest",
+			model: models.Model{Name: "priced", Strategy: "cheapest"},
+			upstreams: []http.HandlerFunc{func(w http.ResponseWriter, r *http.Request) {
+				expensiveCalls++
+				replyWith("expensive", `{"prompt_tokens":10,"completion_tokens":10,"total_tokens":20}`)(w, r)
+			}, replyWith("cheap", `{"prompt_tokens":1000000,"completion_tokens":1000000,"total_tokens":2000000,"prompt_tokens_details":{"cached_tokens":500000}}`)},
+			setup: func(t *testing.T) {
+				// 同一优先级内按价格选择
+				if err := models.DB.Model(&models.ModelWithProvider{}).Where("1 = 1").Update("priority", 0).Error; err != nil {
+					t.Fatal(err)
+				}
+				models.DB.Model(&models.ModelWithProvider{}).Where("provider_model = ?", "priced-0-upstream").Updates(map[string]any{"input_price": 10, "output_price": 30})
+				models.DB.Model(&models.ModelWithProvider{}).Where("provider_model = ?", "priced-1-upstream").Updates(map[string]any{"input_price": 1, "output_price": 2, "cached_price": 0.5})
+			},
+			run: func(t *testing.T, send chatSender) {
+				if w := send("", nil); !strings.Contains(w.Body.String(), "cheap") || expensiveCalls != 0 {
+					t.Fatalf("unexpected body %s, expensive calls %d", w.Body.String(), expensiveCalls)
+				}
+				// 费用在响应处理完成后异步写入 500k*1 + 500k*0.5 + 1M*2 (每百万token)
+				var log models.ChatLog
+				eventually(t, func() bool {
+					log, _ = gorm.G[models.ChatLog](models.DB).Where("status = ?", "success").First(t.Context())
+					return log.Cost != 0
+				})
+				if log.Cost != 2.75 || log.CachedTokens != 500000 {
+					t.Errorf("cost = %v cached_tokens = %d", log.Cost, log.CachedTokens)
+				}
+			},
+		},
+		{
+			name:      "shadow",
+			model:     models.Model{Name: "mirrored"},
+			upstreams: []http.HandlerFunc{replyWith("primary", `{"prompt_tokens":5,"completion_tokens":10,"total_tokens":15}`)},
+			setup: func(t *testing.T) {
+				url := serve(t, func(w http.ResponseWriter, r *http.Request) {
+					body, _ := io.ReadAll(r.Body)
+					shadowModel = gjson.GetBytes(body, "model").String()
+					time.Sleep(20 * time.Millisecond)
+					replyWith("shadow", `{"prompt_tokens":5,"completion_tokens":30,"total_tokens":35}`)(w, r)
+				})
+				provider := models.Provider{Name: "candidate", Type: "openai", Config: `{"base_url":"` + url + `","api_key":"sk-test"}`}
+				if err := gorm.G[models.Provider](models.DB).Create(t.Context(), &provider); err != nil {
+					t.Fatal(err)
+				}
+				if err := models.DB.Model(&models.Model{}).Where("name = ?", "mirrored").Updates(map[string]any{
+					"shadow_provider_id":    provider.ID,
+					"shadow_provider_model": "candidate-model",
+					"shadow_percent":        100,
+				}).Error; err != nil {
+					t.Fatal(err)
+				}
+			},
+			run: func(t *testing.T, send chatSender) {
+				// 客户端只收到主请求的响应
+				if w := send("", nil); !strings.Contains(w.Body.String(), "primary") {
+					t.Fatalf("unexpected body %s", w.Body.String())
+				}
+				var comparison ShadowComparison
+				eventually(t, func() bool {
+					comparison, _ = CompareShadow(t.Context(), "mirrored", time.Now().Add(-time.Hour))
+					return len(comparison.Shadows) == 1 && comparison.Primary.AvgOutputTokens != 0
+				})
+				if shadowModel != "candidate-model" {
+					t.Errorf("shadow upstream model = %q", shadowModel)
+				}
+				shadow := comparison.Shadows[0]
+				if shadow.ProviderName != "candidate" || shadow.Requests != 1 || shadow.ErrorRate != 0 || shadow.AvgOutputTokens != 30 || shadow.AvgTTFT < 20 {
+					t.Errorf("unexpected shadow stats %+v", shadow)
+				}
+				if comparison.Primary.Requests != 1 || comparison.Primary.AvgOutputTokens != 10 {
+					t.Errorf("unexpected primary stats %+v", comparison.Primary)
+				}
+			},
+		},
+		{
+			name:      "routing rules",
+			model:     models.Model{Name: "ruled"},
+			upstreams: []http.HandlerFunc{replyWith("us", ""), replyWith("eu", "")},
+			setup: func(t *testing.T) {
+				models.DB.Model(&models.Provider{}).Where("name = ?", "ruled-0").Update("tags", `["us"]`)
+				models.DB.Model(&models.Provider{}).Where("name = ?", "ruled-1").Update("tags", `["eu"]`)
+				rule := models.RoutingRule{Name: "team a eu only", Enabled: true, Headers: map[string]string{"X-Team": "a"}, IncludeTags: []string{"eu"}}
+				if err := gorm.G[models.RoutingRule](models.DB).Create(t.Context(), &rule); err != nil {
+					t.Fatal(err)
+				}
+			},
+			run: func(t *testing.T, send chatSender) {
+				// 未命中规则时使用优先级更高的us 命中后只能使用eu
+				if w := send("", http.Header{"X-Team": {"b"}}); !strings.Contains(w.Body.String(), "us") {
+					t.Fatalf("unexpected body %s", w.Body.String())
+				}
+				if w := send("", http.Header{"X-Team": {"a"}}); !strings.Contains(w.Body.String(), "eu") {
+					t.Fatalf("unexpected body %s", w.Body.String())
+				}
+				// 粘性路由只在规则允许的提供商中做一致性哈希
+				if err := models.DB.Model(&models.Model{}).Where("name = ?", "ruled").Update("sticky", true).Error; err != nil {
+					t.Fatal(err)
+				}
+				configCache.ClearCache()
+				for i := range 10 {
+					header := http.Header{"X-Team": {"a"}, sessionHeader: {fmt.Sprintf("session-%d", i)}}
+					if w := send("", header); !strings.Contains(w.Body.String(), "eu") {
+						t.Fatalf("unexpected body %s", w.Body.String())
+					}
+				}
+			},
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			initChatTest(t)
+			urls := make([]string, 0, len(tt.upstreams))
+			for _, upstream := range tt.upstreams {
+				urls = append(urls, serve(t, upstream))
+			}
+			addChatModel(t, tt.model, urls...)
+			if tt.setup != nil {
+				tt.setup(t)
+			}
+			tt.run(t, func(body string, header http.Header) *httptest.ResponseRecorder {
+				if body == "" {
+					body = `{"model":"` + tt.model.Name + `","messages":[{"role":"user","content":"hi"}]}`
+				}
+				w := httptest.NewRecorder()
+				c, _ := gin.CreateTestContext(w)
+				c.Request = httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+				for name, values := range header {
+					c.Request.Header[http.CanonicalHeaderKey(name)] = values
+				}
+				// 可能在场景启动的goroutine中调用 因此不使用Fatal
+				if err := BalanceChat(c, "openai", BeforerOpenAI, ProcesserOpenAI); err != nil {
+					t.Errorf("balance chat: %v", err)
+				}
+				return w
+			})
+		})
+	}
+}
@@ -164,9 +164,16 @@ func (cc *ConfigCache) ProvidersBymodelsNameWithCache(ctx context.Context, model
 	}
 
 	return &ProvidersWithlimit{
-		Providers: modelProviders,
-		MaxRetry:  model.MaxRetry,
-		TimeOut:   model.TimeOut,
+		Providers:           modelProviders,
+		MaxRetry:            model.MaxRetry,
+		TimeOut:             model.TimeOut,
+		Strategy:            model.Strategy,
+		Fallbacks:           model.Fallbacks,
+		HedgeDelay:          model.HedgeDelay,
+		Sticky:              model.Sticky,
+		ShadowProviderID:    model.ShadowProviderID,
+		ShadowProviderModel: model.ShadowProviderModel,
+		ShadowPercent:       model.ShadowPercent,
 	}, nil
 }
 
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/atopos31/llmio/models"
+	"gorm.io/gorm"
+)
+
+// expectedOutputTokens 预估费用时假定的输出token数 请求指定的max_tokens更小时以其为准
+const expectedOutputTokens = 1000
+
+// costOf 按关联的每百万token价格计算费用
+// Anthropic缓存写入的token按输入价格计 缓存读取的token按缓存价格计
+func costOf(mp models.ModelWithProvider, usage models.Usage) float64 {
+	cachedPrice := mp.InputPrice
+	if mp.CachedPrice != nil {
+		cachedPrice = *mp.CachedPrice
+	}
+	uncached := max(usage.PromptTokens-usage.CachedTokens, 0) + usage.CacheCreationTokens
+	cached := usage.CachedTokens + usage.CacheReadTokens
+	return (float64(uncached)*mp.InputPrice + float64(cached)*cachedPrice + float64(usage.CompletionTokens)*mp.OutputPrice) / 1e6
+}
+
+// estimateCost 按估算的输入token数与预期的输出token数预估请求费用
+func estimateCost(mp models.ModelWithProvider, promptTokens, maxTokens int) float64 {
+	output := expectedOutputTokens
+	if maxTokens > 0 {
+		output = min(maxTokens, expectedOutputTokens)
+	}
+	return costOf(mp, models.Usage{PromptTokens: int64(promptTokens), CompletionTokens: int64(output)})
+}
+
+// saveCost 响应处理完成得知用量后写入请求日志的费用
+func saveCost(ctx context.Context, logId uint, mp models.ModelWithProvider, usage models.Usage) {
+	cost := costOf(mp, usage)
+	if cost == 0 {
+		return
+	}
+	if _, err := gorm.G[models.ChatLog](models.DB).Where("id = ?", logId).Update(ctx, "cost", cost); err != nil {
+		slog.Error("update chat log cost error", "error", err)
+	}
+}
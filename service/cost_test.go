@@ -0,0 +1,51 @@
+package service
+
+import (
+	"io"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/atopos31/llmio/models"
+)
+
+func TestCostOf(t *testing.T) {
+	cachedPrice := 0.3
+	mp := models.ModelWithProvider{InputPrice: 3, OutputPrice: 15, CachedPrice: &cachedPrice}
+	usage := models.Usage{PromptTokens: 1_000_000, CompletionTokens: 100_000, CachedTokens: 400_000}
+	// 600k*3 + 400k*0.3 + 100k*15 (每百万token)
+	if got, want := costOf(mp, usage), 1.8+0.12+1.5; math.Abs(got-want) > 1e-9 {
+		t.Errorf("cost = %v, want %v", got, want)
+	}
+	// 缓存价格为0时命中缓存的token免费
+	cachedPrice = 0
+	if got, want := costOf(mp, usage), 1.8+1.5; math.Abs(got-want) > 1e-9 {
+		t.Errorf("cost = %v, want %v", got, want)
+	}
+	// 未设置缓存价格时按输入价格计
+	mp.CachedPrice = nil
+	if got, want := costOf(mp, usage), 3+1.5; math.Abs(got-want) > 1e-9 {
+		t.Errorf("cost = %v, want %v", got, want)
+	}
+	// Anthropic的缓存读写不包含在PromptTokens中 200k*3 + 100k*3 + 300k*0.3 + 100k*15
+	cachedPrice = 0.3
+	mp.CachedPrice = &cachedPrice
+	anthropic := models.Usage{PromptTokens: 200_000, CompletionTokens: 100_000, CacheCreationTokens: 100_000, CacheReadTokens: 300_000}
+	if got, want := costOf(mp, anthropic), 0.6+0.3+0.09+1.5; math.Abs(got-want) > 1e-9 {
+		t.Errorf("anthropic cost = %v, want %v", got, want)
+	}
+	mp.CachedPrice = nil
+	if got := estimateCost(mp, 1000, 0); math.Abs(got-(0.003+0.015)) > 1e-9 {
+		t.Errorf("estimated cost = %v", got)
+	}
+}
+
+func TestProcesserAnthropicUsage(t *testing.T) {
+	body := io.NopCloser(strings.NewReader(`{"usage":{"input_tokens":10,"cache_creation_input_tokens":20,"cache_read_input_tokens":30,"output_tokens":5}}`))
+	usage := ProcesserAnthropic(t.Context(), body, false, 0, time.Now()).Usage
+	// 输入token数保持上游input_tokens的口径 缓存读写单独记录
+	if usage.PromptTokens != 10 || usage.TotalTokens != 15 || usage.CacheCreationTokens != 20 || usage.CacheReadTokens != 30 {
+		t.Errorf("usage = %+v", usage)
+	}
+}
@@ -224,7 +224,10 @@ func (s *HealthCheckService) performHealthCheck(ctx context.Context, provider *m
 	}
 
 	// 创建HTTP客户端，设置较短的超时时间
-	client := providers.GetClient(10 * time.Second)
+	client, err := providers.GetClientWithProxy(10*time.Second, providers.ProxyOf(provider.Config))
+	if err != nil {
+		return false, 0, fmt.Sprintf("failed to create client: %v", err)
+	}
 	
 	// 执行请求
 	resp, err := chatModel.Chat(ctx, client, "test-model", requestBody)
@@ -0,0 +1,166 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"github.com/atopos31/llmio/models"
+)
+
+// tokenBucket 令牌桶 容量为每分钟限额 按时间连续补充
+// 请求放行时按估算预留token 结束后按实际用量结算 因此允许扣成负数
+type tokenBucket struct {
+	perMinute int
+	tokens    float64
+	updated   time.Time
+}
+
+// configure 限额变化时按新容量重置 0表示不限制
+func (b *tokenBucket) configure(perMinute int, now time.Time) {
+	if b.perMinute == perMinute {
+		return
+	}
+	b.perMinute = perMinute
+	b.tokens = float64(perMinute)
+	b.updated = now
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.updated); elapsed > 0 {
+		b.tokens = min(float64(b.perMinute), b.tokens+elapsed.Minutes()*float64(b.perMinute))
+		b.updated = now
+	}
+}
+
+// allows 余额是否足以放行n个令牌 未设置限额时总是放行
+// n超过容量时按容量计算 以免单个大请求永远无法放行
+func (b *tokenBucket) allows(now time.Time, n float64) bool {
+	if b.perMinute <= 0 {
+		return true
+	}
+	b.refill(now)
+	return b.tokens >= min(n, float64(b.perMinute))
+}
+
+func (b *tokenBucket) take(now time.Time, n float64) {
+	if b.perMinute <= 0 {
+		return
+	}
+	b.refill(now)
+	b.tokens = min(float64(b.perMinute), b.tokens-n)
+}
+
+// used 当前窗口内已使用的令牌数
+func (b *tokenBucket) used(now time.Time) int {
+	if b.perMinute <= 0 {
+		return 0
+	}
+	b.refill(now)
+	return int(float64(b.perMinute) - b.tokens)
+}
+
+// limiter 单个模型提供商关联的网关侧限额 RPM与TPM使用令牌桶 并发数使用计数器
+type limiter struct {
+	mu             sync.Mutex
+	rpm            tokenBucket
+	tpm            tokenBucket
+	maxConcurrency int
+	inFlight       int
+}
+
+// limiters 模型提供商关联ID -> 限额状态
+var limiters sync.Map
+
+// limiterOf 返回关联的限额状态 并同步关联当前配置的限额
+func limiterOf(mp models.ModelWithProvider) *limiter {
+	value, _ := limiters.LoadOrStore(mp.ID, &limiter{})
+	l := value.(*limiter)
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rpm.configure(mp.RPMLimit, now)
+	l.tpm.configure(mp.TPMLimit, now)
+	l.maxConcurrency = mp.MaxConcurrency
+	return l
+}
+
+// saturatedLocked 任一限额已用尽 或TPM余额不足以预留tokens
+func (l *limiter) saturatedLocked(now time.Time, tokens int64) bool {
+	if l.maxConcurrency > 0 && l.inFlight >= l.maxConcurrency {
+		return true
+	}
+	return !l.rpm.allows(now, 1) || !l.tpm.allows(now, float64(tokens))
+}
+
+// saturated 关联是否无法放行预计使用tokens的请求 用于筛选候选项
+func (l *limiter) saturated(now time.Time, tokens int64) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.saturatedLocked(now, tokens)
+}
+
+// acquire 请求发出前调用 未饱和时占用一个并发名额、消耗一次请求并预留估算的tokens
+// 预留的tokens需在请求结束后通过settle结算
+func (l *limiter) acquire(now time.Time, tokens int64) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.saturatedLocked(now, tokens) {
+		return false
+	}
+	l.inFlight++
+	l.rpm.take(now, 1)
+	l.tpm.take(now, float64(tokens))
+	return true
+}
+
+// release 请求结束时归还并发名额 并唤醒排队中的请求
+func (l *limiter) release() {
+	l.mu.Lock()
+	if l.inFlight > 0 {
+		l.inFlight--
+	}
+	l.mu.Unlock()
+	queue.notify()
+}
+
+// settle 请求结束得知token用量后 按实际用量与预留之差补扣或退还
+// 请求失败时used为0 退还全部预留
+func (l *limiter) settle(reserved, used int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tpm.take(time.Now(), float64(used-reserved))
+}
+
+// Utilization 模型提供商关联的限额使用情况
+type Utilization struct {
+	ModelProviderID uint   `json:"model_provider_id"`
+	ModelName       string `json:"model_name"`
+	ProviderName    string `json:"provider_name"`
+	ProviderModel   string `json:"provider_model"`
+	RPMLimit        int    `json:"rpm_limit"`
+	RPMUsed         int    `json:"rpm_used"`
+	TPMLimit        int    `json:"tpm_limit"`
+	TPMUsed         int    `json:"tpm_used"`
+	MaxConcurrency  int    `json:"max_concurrency"`
+	InFlight        int    `json:"in_flight"`
+	Saturated       bool   `json:"saturated"`
+}
+
+// GetUtilization 返回关联当前的限额使用情况
+func GetUtilization(mp models.ModelWithProvider) Utilization {
+	l := limiterOf(mp)
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return Utilization{
+		ModelProviderID: mp.ID,
+		ProviderModel:   mp.ProviderModel,
+		RPMLimit:        mp.RPMLimit,
+		RPMUsed:         l.rpm.used(now),
+		TPMLimit:        mp.TPMLimit,
+		TPMUsed:         l.tpm.used(now),
+		MaxConcurrency:  mp.MaxConcurrency,
+		InFlight:        l.inFlight,
+		Saturated:       l.saturatedLocked(now, 0),
+	}
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/atopos31/llmio/models"
+)
+
+func TestLimiter(t *testing.T) {
+	limiters.Clear()
+	mp := models.ModelWithProvider{RPMLimit: 2, TPMLimit: 100, MaxConcurrency: 1}
+	mp.ID = 1
+	l := limiterOf(mp)
+	now := time.Now()
+
+	if !l.acquire(now, 0) {
+		t.Fatal("first request rejected")
+	}
+	// 并发已满
+	if l.acquire(now, 0) || !l.saturated(now, 0) {
+		t.Fatal("concurrency limit not enforced")
+	}
+	l.release()
+	if !l.acquire(now, 0) {
+		t.Fatal("second request rejected")
+	}
+	l.release()
+	// 每分钟2次请求已用完 30秒后补充1次
+	if l.acquire(now, 0) {
+		t.Fatal("rpm limit not enforced")
+	}
+	if !l.acquire(now.Add(30*time.Second), 0) {
+		t.Fatal("rpm bucket not refilled")
+	}
+	l.release()
+
+	// token用量超出限额后 补回前不再放行
+	mp.ID = 2
+	l = limiterOf(mp)
+	l.settle(0, 150)
+	if !l.saturated(time.Now(), 0) {
+		t.Fatal("tpm limit not enforced")
+	}
+	utilization := GetUtilization(mp)
+	if utilization.TPMLimit != 100 || utilization.TPMUsed < 149 || !utilization.Saturated {
+		t.Errorf("unexpected utilization %+v", utilization)
+	}
+	if l.saturated(time.Now().Add(31*time.Second), 0) {
+		t.Fatal("tpm bucket not refilled")
+	}
+}
+
+func TestLimiterReservesTokens(t *testing.T) {
+	limiters.Clear()
+	mp := models.ModelWithProvider{TPMLimit: 100}
+	mp.ID = 1
+	l := limiterOf(mp)
+	now := time.Now()
+
+	// 放行时预留估算的token 并发请求不能同时超出限额
+	if !l.acquire(now, 60) {
+		t.Fatal("first request rejected")
+	}
+	if l.acquire(now, 60) || !l.saturated(now, 60) {
+		t.Fatal("reservation not enforced")
+	}
+	// 实际只用了10个token 多预留的退还后可以放行
+	l.settle(60, 10)
+	if !l.acquire(now, 60) {
+		t.Fatal("unused reservation not returned")
+	}
+	// 失败的请求退还全部预留
+	l.settle(60, 0)
+	if used := GetUtilization(mp).TPMUsed; used < 9 || used > 11 {
+		t.Fatalf("tpm used = %d", used)
+	}
+
+	// 超过容量的估算在余额满时仍可放行
+	mp.ID = 2
+	if !limiterOf(mp).acquire(now, 500) {
+		t.Fatal("request larger than limit rejected")
+	}
+}
@@ -0,0 +1,26 @@
+package service
+
+// topTier 返回候选项中优先级最高且仍有可用成员(权重大于0)的一层及其优先级
+// 高优先级层的成员全部失败被移除后 自动落到下一层
+func topTier(items map[uint]int, priorityOf map[uint]int) (map[uint]int, int) {
+	found := false
+	top := 0
+	for id, weight := range items {
+		if weight <= 0 {
+			continue
+		}
+		if priority := priorityOf[id]; !found || priority > top {
+			top, found = priority, true
+		}
+	}
+	if !found {
+		return items, 0
+	}
+	tier := make(map[uint]int)
+	for id, weight := range items {
+		if weight > 0 && priorityOf[id] == top {
+			tier[id] = weight
+		}
+	}
+	return tier, top
+}
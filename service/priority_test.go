@@ -0,0 +1,24 @@
+package service
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestTopTier(t *testing.T) {
+	items := map[uint]int{1: 5, 2: 3, 3: 10, 4: 0}
+	priorityOf := map[uint]int{1: 10, 2: 10, 3: 0, 4: 20}
+
+	tier, priority := topTier(items, priorityOf)
+	if priority != 10 || !maps.Equal(tier, map[uint]int{1: 5, 2: 3}) {
+		t.Fatalf("unexpected tier %d %v", priority, tier)
+	}
+
+	// 高优先级层耗尽后落到下一层
+	delete(items, 1)
+	delete(items, 2)
+	tier, priority = topTier(items, priorityOf)
+	if priority != 0 || !maps.Equal(tier, map[uint]int{3: 10}) {
+		t.Fatalf("unexpected fallback tier %d %v", priority, tier)
+	}
+}
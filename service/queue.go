@@ -0,0 +1,300 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/atopos31/llmio/models"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// priorityHeader 客户端指定排队优先级的请求头 API Key已配置优先级时忽略
+	priorityHeader = "X-Priority"
+	// queueDispatchInterval 定期调度间隔 令牌桶补充与冷却结束不会主动通知队列
+	queueDispatchInterval = 100 * time.Millisecond
+	// queueWaitSmoothing 估算Retry-After时最近一次等待时间的权重
+	queueWaitSmoothing = 0.2
+)
+
+// QueueError 排队失败 Full为true表示队列已满 否则为等待超时
+type QueueError struct {
+	Full       bool
+	RetryAfter time.Duration
+}
+
+func (e *QueueError) Error() string {
+	if e.Full {
+		return "request queue is full"
+	}
+	return "timed out waiting in request queue"
+}
+
+// ticket 一个排队中的请求
+type ticket struct {
+	priority int
+	tenant   string // 按API Key区分租户 同优先级的租户轮流调度
+	seq      uint64
+	enqueued time.Time
+	try      func() bool // 轮到时尝试占用名额 成功后离开队列
+	admitted chan struct{}
+}
+
+// requestQueue 所有可用关联均达到网关侧限额时的有界等待队列
+// 按优先级从高到低调度 同优先级时最久未被调度的租户优先 同租户内先进先出
+type requestQueue struct {
+	mu         sync.Mutex
+	waiters    []*ticket
+	seq        uint64
+	dispatched uint64
+	lastServed map[string]uint64 // 租户 -> 最近一次被调度的序号
+	wake       chan struct{}
+	start      sync.Once
+
+	admitted  int64
+	rejected  int64
+	timedOut  int64
+	totalWait time.Duration
+	maxWait   time.Duration
+	ewmaWait  float64 // 等待时间的指数移动平均(纳秒) 用于估算Retry-After
+}
+
+var queue = newRequestQueue()
+
+func newRequestQueue() *requestQueue {
+	return &requestQueue{
+		lastServed: make(map[string]uint64),
+		wake:       make(chan struct{}, 1),
+	}
+}
+
+// notify 有名额被归还时唤醒调度 不阻塞
+func (q *requestQueue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// loop 收到通知或定期调度排队中的请求
+func (q *requestQueue) loop() {
+	ticker := time.NewTicker(queueDispatchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-q.wake:
+		case <-ticker.C:
+		}
+		q.dispatch()
+	}
+}
+
+// wait 排队直到try成功 队列已满或超过timeout时返回*QueueError
+func (q *requestQueue) wait(ctx context.Context, capacity int, t *ticket, timeout time.Duration) error {
+	q.start.Do(func() { go q.loop() })
+	q.mu.Lock()
+	if len(q.waiters) >= capacity {
+		q.rejected++
+		retryAfter := q.retryAfterLocked()
+		q.mu.Unlock()
+		return &QueueError{Full: true, RetryAfter: retryAfter}
+	}
+	q.seq++
+	t.seq = q.seq
+	t.enqueued = time.Now()
+	t.admitted = make(chan struct{})
+	q.waiters = append(q.waiters, t)
+	q.mu.Unlock()
+	// 入队前可能已有名额被归还
+	q.notify()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	var err error
+	select {
+	case <-t.admitted:
+		return nil
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-timer.C:
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.removeLocked(t) {
+		// 超时的同时已被调度 视为放行
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	q.timedOut++
+	return &QueueError{RetryAfter: q.retryAfterLocked()}
+}
+
+// dispatch 按调度顺序依次尝试排队中的请求
+// 不同请求可用的关联不同 排在前面的请求无法放行时继续尝试后面的请求
+func (q *requestQueue) dispatch() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	tried := make(map[*ticket]bool, len(q.waiters))
+	for {
+		var next *ticket
+		for _, t := range q.waiters {
+			if !tried[t] && (next == nil || q.beforeLocked(t, next)) {
+				next = t
+			}
+		}
+		if next == nil {
+			break
+		}
+		tried[next] = true
+		if !next.try() {
+			continue
+		}
+		q.removeLocked(next)
+		q.dispatched++
+		q.lastServed[next.tenant] = q.dispatched
+		q.observeLocked(time.Since(next.enqueued))
+		close(next.admitted)
+	}
+	// 只保留仍在排队的租户的调度记录
+	for tenant := range q.lastServed {
+		if !q.queuedLocked(tenant) {
+			delete(q.lastServed, tenant)
+		}
+	}
+}
+
+// beforeLocked a是否应先于b调度
+func (q *requestQueue) beforeLocked(a, b *ticket) bool {
+	if a.priority != b.priority {
+		return a.priority > b.priority
+	}
+	if served, other := q.lastServed[a.tenant], q.lastServed[b.tenant]; served != other {
+		return served < other
+	}
+	return a.seq < b.seq
+}
+
+func (q *requestQueue) queuedLocked(tenant string) bool {
+	for _, t := range q.waiters {
+		if t.tenant == tenant {
+			return true
+		}
+	}
+	return false
+}
+
+func (q *requestQueue) removeLocked(t *ticket) bool {
+	for i, waiter := range q.waiters {
+		if waiter == t {
+			q.waiters = append(q.waiters[:i], q.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (q *requestQueue) observeLocked(wait time.Duration) {
+	q.admitted++
+	q.totalWait += wait
+	q.maxWait = max(q.maxWait, wait)
+	if q.admitted == 1 {
+		q.ewmaWait = float64(wait)
+	} else {
+		q.ewmaWait = queueWaitSmoothing*float64(wait) + (1-queueWaitSmoothing)*q.ewmaWait
+	}
+}
+
+// retryAfterLocked 按近期平均等待时间估算客户端的重试间隔 至少1秒
+func (q *requestQueue) retryAfterLocked() time.Duration {
+	return max(time.Duration(math.Ceil(time.Duration(q.ewmaWait).Seconds()))*time.Second, time.Second)
+}
+
+// admission 排队轮到时选中并已占用名额的关联
+type admission struct {
+	item     uint
+	priority int
+	limits   *limiter
+}
+
+// waitInQueue 按系统配置的队列长度排队 最多等待模型的超时时间(秒)
+// 未开启排队时返回可回退的错误
+func waitInQueue(c *gin.Context, timeOut int, try func() (admission, bool)) (*admission, error) {
+	ctx := c.Request.Context()
+	config, err := GetSystemConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if config.QueueSize <= 0 {
+		return nil, exhausted(errors.New("all model providers are saturated"))
+	}
+	priority, tenant := queueIdentity(c, config)
+	var admitted admission
+	t := &ticket{
+		priority: priority,
+		tenant:   tenant,
+		try: func() bool {
+			var ok bool
+			admitted, ok = try()
+			return ok
+		},
+	}
+	if err := queue.wait(ctx, config.QueueSize, t, time.Duration(timeOut)*time.Second); err != nil {
+		return nil, err
+	}
+	return &admitted, nil
+}
+
+// QueueStats 请求队列指标
+type QueueStats struct {
+	Length     int     `json:"length"`
+	Capacity   int     `json:"capacity"`
+	Admitted   int64   `json:"admitted"`    // 排队后放行的请求数
+	Rejected   int64   `json:"rejected"`    // 队列已满被拒绝的请求数
+	TimedOut   int64   `json:"timed_out"`   // 等待超时的请求数
+	AvgWaitMs  float64 `json:"avg_wait_ms"` // 放行请求的平均等待时间
+	MaxWaitMs  float64 `json:"max_wait_ms"`
+	OldestMs   float64 `json:"oldest_ms"` // 当前排队最久的请求已等待的时间
+	RetryAfter int     `json:"retry_after"`
+}
+
+// GetQueueStats 返回请求队列的当前长度与等待时间指标
+func GetQueueStats(ctx context.Context) QueueStats {
+	stats := QueueStats{}
+	if config, err := GetSystemConfig(ctx); err == nil {
+		stats.Capacity = config.QueueSize
+	}
+	q := queue
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	stats.Length = len(q.waiters)
+	stats.Admitted = q.admitted
+	stats.Rejected = q.rejected
+	stats.TimedOut = q.timedOut
+	if q.admitted > 0 {
+		stats.AvgWaitMs = float64(q.totalWait) / float64(q.admitted) / float64(time.Millisecond)
+	}
+	stats.MaxWaitMs = float64(q.maxWait) / float64(time.Millisecond)
+	for _, t := range q.waiters {
+		stats.OldestMs = max(stats.OldestMs, float64(time.Since(t.enqueued))/float64(time.Millisecond))
+	}
+	stats.RetryAfter = int(q.retryAfterLocked().Seconds())
+	return stats
+}
+
+// queueIdentity 从请求中解析排队优先级与租户
+// API Key在系统配置中设置了优先级时以其为准 否则使用X-Priority请求头
+func queueIdentity(c *gin.Context, config models.SystemConfig) (priority int, tenant string) {
+	tenant = apiKeyOf(c)
+	if priority, ok := config.QueuePriorities[tenant]; ok && tenant != "" {
+		return priority, tenant
+	}
+	priority, _ = strconv.Atoi(c.GetHeader(priorityHeader))
+	return priority, tenant
+}
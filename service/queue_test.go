@@ -0,0 +1,77 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRequestQueueOrder(t *testing.T) {
+	q := newRequestQueue()
+	var order []string
+	add := func(name, tenant string, priority int) {
+		q.seq++
+		q.waiters = append(q.waiters, &ticket{
+			priority: priority,
+			tenant:   tenant,
+			seq:      q.seq,
+			enqueued: time.Now(),
+			admitted: make(chan struct{}),
+			try: func() bool {
+				order = append(order, name)
+				return true
+			},
+		})
+	}
+	add("a1", "a", 0)
+	add("a2", "a", 0)
+	add("b1", "b", 0)
+	add("c1", "c", 1)
+	q.dispatch()
+
+	// 高优先级先调度 同优先级的租户轮流调度
+	want := []string{"c1", "a1", "b1", "a2"}
+	if len(order) != len(want) {
+		t.Fatalf("order = %v, want %v", order, want)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("order = %v, want %v", order, want)
+		}
+	}
+	if len(q.waiters) != 0 || q.admitted != 4 {
+		t.Errorf("waiters = %d admitted = %d", len(q.waiters), q.admitted)
+	}
+}
+
+func TestRequestQueueRejects(t *testing.T) {
+	q := newRequestQueue()
+	never := func() bool { return false }
+
+	done := make(chan error)
+	go func() {
+		done <- q.wait(t.Context(), 1, &ticket{try: never}, 200*time.Millisecond)
+	}()
+	for {
+		q.mu.Lock()
+		n := len(q.waiters)
+		q.mu.Unlock()
+		if n == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// 队列已满
+	var queueErr *QueueError
+	if err := q.wait(t.Context(), 1, &ticket{try: never}, time.Second); !errors.As(err, &queueErr) || !queueErr.Full {
+		t.Fatalf("expected full queue error, got %v", err)
+	}
+	// 等待超时
+	if err := <-done; !errors.As(err, &queueErr) || queueErr.Full || queueErr.RetryAfter < time.Second {
+		t.Fatalf("expected timeout error, got %v", err)
+	}
+	if q.rejected != 1 || q.timedOut != 1 || len(q.waiters) != 0 {
+		t.Errorf("rejected = %d timed out = %d waiters = %d", q.rejected, q.timedOut, len(q.waiters))
+	}
+}
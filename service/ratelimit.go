@@ -0,0 +1,100 @@
+package service
+
+import (
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/atopos31/llmio/providers"
+)
+
+const (
+	// defaultRateLimitCooldown 429未返回Retry-After与重置时间时的冷却时间
+	defaultRateLimitCooldown = 5 * time.Second
+	// lowHeadroom 剩余限额比例低于该值时按比例降低权重
+	lowHeadroom = 0.1
+)
+
+// rateLimitState 单个模型提供商关联的上游限流状态
+type rateLimitState struct {
+	mu            sync.Mutex
+	cooldownUntil time.Time
+	requests      *providers.Budget
+	tokens        *providers.Budget
+}
+
+// rateLimits 模型提供商关联ID -> 限流状态
+var rateLimits sync.Map
+
+func rateLimitOf(id uint) *rateLimitState {
+	state, _ := rateLimits.LoadOrStore(id, &rateLimitState{})
+	return state.(*rateLimitState)
+}
+
+// observe 根据上游响应头更新剩余限额 429或限额耗尽时冷却到重置时间
+func (s *rateLimitState) observe(now time.Time, statusCode int, header http.Header) {
+	if header == nil {
+		return
+	}
+	rl := providers.ParseRateLimit(header, now)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if rl.Requests != nil {
+		s.requests = rl.Requests
+	}
+	if rl.Tokens != nil {
+		s.tokens = rl.Tokens
+	}
+
+	var until time.Time
+	if rl.RetryAfter > 0 {
+		until = now.Add(rl.RetryAfter)
+	}
+	// 已耗尽的限额冷却到其重置时间
+	for _, budget := range []*providers.Budget{rl.Requests, rl.Tokens} {
+		if budget != nil && budget.Remaining <= 0 && budget.Reset.After(until) {
+			until = budget.Reset
+		}
+	}
+	if statusCode == http.StatusTooManyRequests && !until.After(now) {
+		until = now.Add(defaultRateLimitCooldown)
+	}
+	if until.After(s.cooldownUntil) {
+		s.cooldownUntil = until
+	}
+}
+
+// coolingDown 关联是否处于限流冷却中
+func (s *rateLimitState) coolingDown(now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return now.Before(s.cooldownUntil)
+}
+
+// headroom 尚未重置的限额中剩余比例的最小值 没有限额信息时为1
+func (s *rateLimitState) headroom(now time.Time) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	headroom := 1.0
+	for _, budget := range []*providers.Budget{s.requests, s.tokens} {
+		if budget == nil || budget.Limit <= 0 || !budget.Reset.After(now) {
+			continue
+		}
+		headroom = min(headroom, float64(max(budget.Remaining, 0))/float64(budget.Limit))
+	}
+	return headroom
+}
+
+// applyRateLimitHeadroom 剩余限额不足lowHeadroom的关联按比例降低权重 使负载均衡避开即将触发限流的上游
+func applyRateLimitHeadroom(items map[uint]int) map[uint]int {
+	now := time.Now()
+	weights := make(map[uint]int, len(items))
+	for id, weight := range items {
+		if headroom := rateLimitOf(id).headroom(now); weight > 0 && headroom < lowHeadroom {
+			weight = max(1, int(math.Round(float64(weight)*headroom/lowHeadroom)))
+		}
+		weights[id] = weight
+	}
+	return weights
+}
@@ -0,0 +1,32 @@
+package service
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRateLimitHeadroom(t *testing.T) {
+	rateLimits.Clear()
+	now := time.Now()
+	header := http.Header{}
+	header.Set("x-ratelimit-limit-requests", "100")
+	header.Set("x-ratelimit-remaining-requests", "2")
+	header.Set("x-ratelimit-reset-requests", "30s")
+	rateLimitOf(1).observe(now, http.StatusOK, header)
+
+	weights := applyRateLimitHeadroom(map[uint]int{1: 10, 2: 10})
+	// 剩余2%的限额 权重降为 10*0.02/0.1
+	if weights[1] != 2 || weights[2] != 10 {
+		t.Errorf("unexpected weights %v", weights)
+	}
+	if rateLimitOf(1).coolingDown(now) {
+		t.Error("should not cool down while budget remains")
+	}
+
+	header.Set("x-ratelimit-remaining-requests", "0")
+	rateLimitOf(1).observe(now, http.StatusOK, header)
+	if !rateLimitOf(1).coolingDown(now.Add(29*time.Second)) || rateLimitOf(1).coolingDown(now.Add(31*time.Second)) {
+		t.Error("exhausted budget should cool down until reset")
+	}
+}
@@ -0,0 +1,290 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/atopos31/llmio/balancer"
+	"github.com/atopos31/llmio/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RuleInput 路由规则匹配所需的请求信息
+type RuleInput struct {
+	Model    string
+	Header   http.Header
+	APIKey   string
+	Stream   bool
+	ToolCall bool
+	Image    bool
+}
+
+// ruleInputOf 从请求中提取路由规则匹配所需的信息
+func ruleInputOf(c *gin.Context, before *before) RuleInput {
+	return RuleInput{
+		Model:    before.model,
+		Header:   c.Request.Header,
+		APIKey:   apiKeyOf(c),
+		Stream:   before.stream,
+		ToolCall: before.toolCall,
+		Image:    before.image,
+	}
+}
+
+// apiKeyOf 请求使用的API Key 兼容x-api-key与Bearer两种写法
+func apiKeyOf(c *gin.Context) string {
+	if key := c.GetHeader("x-api-key"); key != "" {
+		return key
+	}
+	if auth := c.GetHeader("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	return ""
+}
+
+// MatchedRule 命中的路由规则
+type MatchedRule struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
+}
+
+// RuleResult 命中的路由规则合并后的动作
+type RuleResult struct {
+	Matched          []MatchedRule `json:"matched"`
+	IncludeTags      [][]string    `json:"include_tags"` // 每条规则的标签限制 提供商需同时满足
+	ExcludeTags      []string      `json:"exclude_tags"`
+	ExcludeProviders []uint        `json:"exclude_providers"`
+	Strategy         string        `json:"strategy"`
+}
+
+// allows 判断提供商是否满足命中规则的限制
+func (r RuleResult) allows(provider models.Provider) bool {
+	if slices.Contains(r.ExcludeProviders, provider.ID) {
+		return false
+	}
+	for _, tag := range provider.Tags {
+		if slices.Contains(r.ExcludeTags, tag) {
+			return false
+		}
+	}
+	for _, tags := range r.IncludeTags {
+		if !slices.ContainsFunc(provider.Tags, func(tag string) bool { return slices.Contains(tags, tag) }) {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidateRule 检查规则中的策略是否有效
+func ValidateRule(rule models.RoutingRule) error {
+	if !balancer.ValidStrategy(rule.Strategy) {
+		return errors.New("invalid strategy: " + rule.Strategy)
+	}
+	return nil
+}
+
+// compileGlob 将通配模式编译为正则 *匹配任意字符串(包括/) ?匹配单个字符
+// 模型名称与请求头(如User-Agent)中常含有/ 因此不使用path.Match
+func compileGlob(pattern string) *regexp.Regexp {
+	var expr strings.Builder
+	expr.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			expr.WriteString(".*")
+		case '?':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	expr.WriteString("$")
+	return regexp.MustCompile(expr.String())
+}
+
+// compiledRule 通配模式已预先编译的路由规则
+type compiledRule struct {
+	models.RoutingRule
+	model   *regexp.Regexp // ModelPattern为空时为nil
+	headers map[string]*regexp.Regexp
+}
+
+func compileRule(rule models.RoutingRule) compiledRule {
+	compiled := compiledRule{RoutingRule: rule, headers: make(map[string]*regexp.Regexp, len(rule.Headers))}
+	if rule.ModelPattern != "" {
+		compiled.model = compileGlob(rule.ModelPattern)
+	}
+	for name, pattern := range rule.Headers {
+		compiled.headers[name] = compileGlob(pattern)
+	}
+	return compiled
+}
+
+// matches 判断规则的全部条件是否满足
+func matches(rule compiledRule, input RuleInput) bool {
+	if rule.model != nil && !rule.model.MatchString(input.Model) {
+		return false
+	}
+	// 请求未携带的请求头只匹配显式的空模式 以免*匹配到所有请求
+	for name, pattern := range rule.headers {
+		values := input.Header.Values(name)
+		if len(values) == 0 {
+			if rule.Headers[name] != "" {
+				return false
+			}
+			continue
+		}
+		if !pattern.MatchString(values[0]) {
+			return false
+		}
+	}
+	if len(rule.APIKeys) != 0 && !slices.Contains(rule.APIKeys, input.APIKey) {
+		return false
+	}
+	if rule.Stream != nil && *rule.Stream != input.Stream {
+		return false
+	}
+	if rule.ToolCall != nil && *rule.ToolCall != input.ToolCall {
+		return false
+	}
+	if rule.Image != nil && *rule.Image != input.Image {
+		return false
+	}
+	return true
+}
+
+// evaluateRules 按顺序匹配规则并合并命中规则的动作
+func evaluateRules(rules []compiledRule, input RuleInput) RuleResult {
+	result := RuleResult{Matched: make([]MatchedRule, 0)}
+	for _, rule := range rules {
+		if !rule.Enabled || !matches(rule, input) {
+			continue
+		}
+		result.Matched = append(result.Matched, MatchedRule{ID: rule.ID, Name: rule.Name})
+		if len(rule.IncludeTags) != 0 {
+			result.IncludeTags = append(result.IncludeTags, rule.IncludeTags)
+		}
+		result.ExcludeTags = append(result.ExcludeTags, rule.ExcludeTags...)
+		result.ExcludeProviders = append(result.ExcludeProviders, rule.ExcludeProviders...)
+		if result.Strategy == "" {
+			result.Strategy = rule.Strategy
+		}
+	}
+	return result
+}
+
+var (
+	routingRulesMu     sync.RWMutex
+	routingRules       []compiledRule
+	routingRulesLoaded bool
+)
+
+// enabledRules 获取按匹配顺序排列的启用规则 首次读取后缓存在内存中
+func enabledRules(ctx context.Context) ([]compiledRule, error) {
+	routingRulesMu.RLock()
+	cached, loaded := routingRules, routingRulesLoaded
+	routingRulesMu.RUnlock()
+	if loaded {
+		return cached, nil
+	}
+	rules, err := gorm.G[models.RoutingRule](models.DB).Where("enabled = ?", true).Order("priority DESC, id ASC").Find(ctx)
+	if err != nil {
+		return nil, err
+	}
+	compiled := make([]compiledRule, 0, len(rules))
+	for _, rule := range rules {
+		compiled = append(compiled, compileRule(rule))
+	}
+	routingRulesMu.Lock()
+	routingRules, routingRulesLoaded = compiled, true
+	routingRulesMu.Unlock()
+	return compiled, nil
+}
+
+// InvalidateRules 路由规则增删改后清除缓存 下次匹配时重新加载
+func InvalidateRules() {
+	routingRulesMu.Lock()
+	routingRules, routingRulesLoaded = nil, false
+	routingRulesMu.Unlock()
+}
+
+// MatchRules 按优先级从高到低匹配所有启用的路由规则
+func MatchRules(ctx context.Context, input RuleInput) (RuleResult, error) {
+	rules, err := enabledRules(ctx)
+	if err != nil {
+		return RuleResult{}, err
+	}
+	return evaluateRules(rules, input), nil
+}
+
+// RuleCandidate 试运行中模型的一个关联及其是否被规则允许
+type RuleCandidate struct {
+	ModelWithProviderID uint     `json:"model_with_provider_id"`
+	ProviderID          uint     `json:"provider_id"`
+	ProviderName        string   `json:"provider_name"`
+	ProviderModel       string   `json:"provider_model"`
+	Tags                []string `json:"tags"`
+	Allowed             bool     `json:"allowed"`
+}
+
+// RuleDryRun 路由规则试运行结果
+type RuleDryRun struct {
+	RuleResult
+	EffectiveStrategy string          `json:"effective_strategy"` // 生效的负载均衡策略 为空表示加权随机
+	Candidates        []RuleCandidate `json:"candidates"`
+}
+
+// DryRunRules 对模拟请求匹配路由规则 返回命中的规则、生效的策略以及模型各关联是否可用
+// 不考虑健康状态、熔断与限额等运行时过滤
+func DryRunRules(ctx context.Context, input RuleInput) (RuleDryRun, error) {
+	result, err := MatchRules(ctx, input)
+	if err != nil {
+		return RuleDryRun{}, err
+	}
+	dryRun := RuleDryRun{RuleResult: result, Candidates: make([]RuleCandidate, 0)}
+	model, err := gorm.G[models.Model](models.DB).Where("name = ?", input.Model).First(ctx)
+	if err != nil {
+		return dryRun, err
+	}
+	dryRun.EffectiveStrategy = model.Strategy
+	if result.Strategy != "" {
+		dryRun.EffectiveStrategy = result.Strategy
+	}
+	associations, err := gorm.G[models.ModelWithProvider](models.DB).Where("model_id = ?", model.ID).Find(ctx)
+	if err != nil {
+		return dryRun, err
+	}
+	providerIDs := make([]uint, 0, len(associations))
+	for _, mp := range associations {
+		providerIDs = append(providerIDs, mp.ProviderID)
+	}
+	providers, err := gorm.G[models.Provider](models.DB).Where("id IN ?", providerIDs).Find(ctx)
+	if err != nil {
+		return dryRun, err
+	}
+	providerMap := make(map[uint]models.Provider, len(providers))
+	for _, provider := range providers {
+		providerMap[provider.ID] = provider
+	}
+	for _, mp := range associations {
+		provider, ok := providerMap[mp.ProviderID]
+		if !ok {
+			continue
+		}
+		dryRun.Candidates = append(dryRun.Candidates, RuleCandidate{
+			ModelWithProviderID: mp.ID,
+			ProviderID:          provider.ID,
+			ProviderName:        provider.Name,
+			ProviderModel:       mp.ProviderModel,
+			Tags:                provider.Tags,
+			Allowed:             result.allows(provider),
+		})
+	}
+	return dryRun, nil
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/atopos31/llmio/models"
+	"gorm.io/gorm"
+)
+
+func TestEvaluateRules(t *testing.T) {
+	yes := true
+	rules := []compiledRule{
+		compileRule(models.RoutingRule{Name: "team a", Enabled: true, APIKeys: []string{"sk-a"}, IncludeTags: []string{"eu"}, Strategy: "lowest_latency"}),
+		compileRule(models.RoutingRule{Name: "agents", Enabled: true, ModelPattern: "claude-*", ToolCall: &yes, ExcludeTags: []string{"flaky"}, Strategy: "least_inflight"}),
+		compileRule(models.RoutingRule{Name: "disabled", Enabled: false, ExcludeProviders: []uint{1}}),
+		compileRule(models.RoutingRule{Name: "mobile", Enabled: true, Headers: map[string]string{"User-Agent": "*Mobile*"}, ExcludeProviders: []uint{2}}),
+		compileRule(models.RoutingRule{Name: "any team", Enabled: true, Headers: map[string]string{"X-Team": "*"}, ExcludeTags: []string{"us"}}),
+		compileRule(models.RoutingRule{Name: "no tenant", Enabled: true, Headers: map[string]string{"X-Tenant": ""}, Strategy: "cheapest"}),
+	}
+	eu := models.Provider{Tags: []string{"eu"}}
+	eu.ID = 1
+	flakyEU := models.Provider{Tags: []string{"eu", "flaky"}}
+	flakyEU.ID = 2
+	us := models.Provider{Tags: []string{"us"}}
+	us.ID = 3
+
+	tests := []struct {
+		name     string
+		input    RuleInput
+		matched  int
+		strategy string
+		allowed  []bool // eu flakyEU us
+	}{
+		// 未携带X-Tenant的请求命中显式空模式的规则 未携带X-Team的请求不命中*
+		{"no match", RuleInput{Model: "gpt-4o", APIKey: "sk-b", Header: http.Header{"X-Tenant": {"t1"}}}, 0, "", []bool{true, true, true}},
+		{"no tenant", RuleInput{Model: "gpt-4o", APIKey: "sk-b"}, 1, "cheapest", []bool{true, true, true}},
+		{"team a", RuleInput{Model: "gpt-4o", APIKey: "sk-a"}, 2, "lowest_latency", []bool{true, true, false}},
+		{"team a agent", RuleInput{Model: "claude-sonnet", APIKey: "sk-a", ToolCall: true}, 3, "lowest_latency", []bool{true, false, false}},
+		{"agent without tools", RuleInput{Model: "claude-sonnet", Header: http.Header{"X-Tenant": {"t1"}}}, 0, "", []bool{true, true, true}},
+		{"mobile", RuleInput{Model: "gpt-4o", Header: http.Header{"User-Agent": {"App Mobile/1.0"}, "X-Tenant": {"t1"}}}, 1, "", []bool{true, false, true}},
+		{"any team", RuleInput{Model: "gpt-4o", Header: http.Header{"X-Team": {"b"}, "X-Tenant": {"t1"}}}, 1, "", []bool{true, true, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := evaluateRules(rules, tt.input)
+			if len(result.Matched) != tt.matched || result.Strategy != tt.strategy {
+				t.Fatalf("matched = %v strategy = %q", result.Matched, result.Strategy)
+			}
+			for i, provider := range []models.Provider{eu, flakyEU, us} {
+				if result.allows(provider) != tt.allowed[i] {
+					t.Errorf("allows(%v) = %v", provider.Tags, !tt.allowed[i])
+				}
+			}
+		})
+	}
+}
+
+func TestMatchRulesCache(t *testing.T) {
+	initChatTest(t)
+	ctx := t.Context()
+	rule := models.RoutingRule{Name: "claude", Enabled: true, ModelPattern: "claude-*"}
+	if err := gorm.G[models.RoutingRule](models.DB).Create(ctx, &rule); err != nil {
+		t.Fatal(err)
+	}
+	input := RuleInput{Model: "claude-sonnet"}
+	if result, err := MatchRules(ctx, input); err != nil || len(result.Matched) != 1 {
+		t.Fatalf("matched = %v, err = %v", result.Matched, err)
+	}
+	// 规则缓存在内存中 清除缓存后才读取到变更
+	if err := models.DB.Model(&models.RoutingRule{}).Where("id = ?", rule.ID).Update("enabled", false).Error; err != nil {
+		t.Fatal(err)
+	}
+	if result, _ := MatchRules(ctx, input); len(result.Matched) != 1 {
+		t.Fatalf("rules reloaded without invalidation: %v", result.Matched)
+	}
+	InvalidateRules()
+	if result, _ := MatchRules(ctx, input); len(result.Matched) != 0 {
+		t.Fatalf("disabled rule still matched: %v", result.Matched)
+	}
+}
+
+func TestDryRunRules(t *testing.T) {
+	initChatTest(t)
+	ctx := t.Context()
+	addChatModel(t, models.Model{Name: "dry"}, "http://us", "http://eu")
+	models.DB.Model(&models.Provider{}).Where("name = ?", "dry-1").Update("tags", `["eu"]`)
+	rule := models.RoutingRule{Name: "eu only", Enabled: true, IncludeTags: []string{"eu"}, Strategy: "cheapest"}
+	if err := gorm.G[models.RoutingRule](models.DB).Create(ctx, &rule); err != nil {
+		t.Fatal(err)
+	}
+
+	dryRun, err := DryRunRules(ctx, RuleInput{Model: "dry"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dryRun.EffectiveStrategy != "cheapest" || len(dryRun.Candidates) != 2 {
+		t.Fatalf("dry run = %+v", dryRun)
+	}
+	for _, candidate := range dryRun.Candidates {
+		if candidate.Allowed != (candidate.ProviderName == "dry-1") {
+			t.Errorf("candidate %s allowed = %v", candidate.ProviderName, candidate.Allowed)
+		}
+	}
+}
+
+func TestValidateRule(t *testing.T) {
+	if err := ValidateRule(models.RoutingRule{Strategy: "unknown"}); err == nil {
+		t.Error("expected invalid strategy error")
+	}
+	if err := ValidateRule(models.RoutingRule{ModelPattern: "gpt-*", Strategy: "cheapest"}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCompileGlob(t *testing.T) {
+	tests := []struct {
+		pattern, s string
+		want       bool
+	}{
+		{"claude-*", "claude-sonnet-4", true},
+		{"claude-*", "gpt-4o", false},
+		{"meta-llama/*", "meta-llama/Llama-3.1-8B", true},
+		{"*Mobile*", "App Mobile/1.0", true},
+		{"gpt-4?", "gpt-4o", true},
+		{"gpt-4.1", "gpt-4x1", false},
+		{"a", "A", false},
+	}
+	for _, tt := range tests {
+		if got := compileGlob(tt.pattern).MatchString(tt.s); got != tt.want {
+			t.Errorf("compileGlob(%q).MatchString(%q) = %v", tt.pattern, tt.s, got)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"github.com/atopos31/llmio/models"
+	"github.com/atopos31/llmio/providers"
+	"gorm.io/gorm"
+)
+
+// shadow 按模型配置的比例将请求复制一份异步发往影子目标
+// 影子请求的响应不返回给客户端 结果只写入影子请求日志
+func shadow(style string, before *before, config *ProvidersWithlimit, processer Processer) {
+	if config.ShadowProviderID == 0 || config.ShadowPercent <= 0 || rand.IntN(100) >= config.ShadowPercent {
+		return
+	}
+	go func() {
+		log := replayShadow(style, before, config, processer)
+		if err := gorm.G[models.ShadowLog](models.DB).Create(context.Background(), &log); err != nil {
+			slog.Error("save shadow log error", "error", err)
+		}
+	}()
+}
+
+// replayShadow 向影子目标重放原始请求 读完整个响应以统计首字时间与用量
+func replayShadow(style string, before *before, config *ProvidersWithlimit, processer Processer) models.ShadowLog {
+	log := models.ShadowLog{
+		Name:          before.model,
+		ProviderModel: config.ShadowProviderModel,
+		Status:        "success",
+		Style:         style,
+	}
+	fail := func(err error) models.ShadowLog {
+		log.Status = "error"
+		log.Error = err.Error()
+		return log
+	}
+
+	ctx := context.Background()
+	if config.TimeOut > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(config.TimeOut)*time.Second)
+		defer cancel()
+	}
+	provider, err := gorm.G[models.Provider](models.DB).Where("id = ?", config.ShadowProviderID).First(ctx)
+	if err != nil {
+		return fail(err)
+	}
+	log.ProviderName = provider.Name
+	chatModel, err := providers.NewWithStyle(style, provider.Type, provider.Config)
+	if err != nil {
+		return fail(err)
+	}
+	client, err := providers.GetClientWithProxy(time.Second*time.Duration(config.TimeOut)/3, providers.ProxyOf(provider.Config))
+	if err != nil {
+		return fail(err)
+	}
+
+	start := time.Now()
+	res, err := chatModel.Chat(ctx, client, config.ShadowProviderModel, before.raw)
+	if err != nil {
+		return fail(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(res.Body)
+		return fail(fmt.Errorf("status: %d, body: %s", res.StatusCode, string(body)))
+	}
+
+	result := processer(ctx, res.Body, before.stream, 0, start)
+	log.Usage = result.Usage
+	log.FirstChunkTime = result.FirstChunkTime
+	log.ChunkTime = result.ChunkTime
+	if result.Status == "error" {
+		log.Status = "error"
+		log.Error = result.Error
+	}
+	return log
+}
+
+// ShadowStats 一组请求的表现 用于对比主请求与影子请求
+type ShadowStats struct {
+	ProviderName    string  `json:"provider_name,omitempty"`
+	ProviderModel   string  `json:"provider_model,omitempty"`
+	Requests        int64   `json:"requests"`
+	Errors          int64   `json:"errors"`
+	ErrorRate       float64 `json:"error_rate"`
+	AvgTTFT         float64 `json:"avg_ttft_ms"`       // 成功请求的平均首字时间
+	AvgOutputTokens float64 `json:"avg_output_tokens"` // 成功请求的平均输出token数
+}
+
+// ShadowComparison 模型的主请求与各影子目标在同一时间窗口内的对比
+type ShadowComparison struct {
+	Model   string        `json:"model"`
+	Since   time.Time     `json:"since"`
+	Primary ShadowStats   `json:"primary"`
+	Shadows []ShadowStats `json:"shadows"` // 按影子目标分组 目标变更后新旧目标分别统计
+}
+
+// shadowStatsColumns 统计请求数、错误数 以及成功请求的平均首字时间与输出token数
+const shadowStatsColumns = "COUNT(*) as requests, " +
+	"COALESCE(SUM(CASE WHEN status = 'error' THEN 1 ELSE 0 END), 0) as errors, " +
+	"COALESCE(AVG(CASE WHEN status = 'success' THEN first_chunk_time END), 0) as avg_ttft, " +
+	"COALESCE(AVG(CASE WHEN status = 'success' THEN completion_tokens END), 0) as avg_output_tokens"
+
+// CompareShadow 对比模型在since之后的主请求与影子请求 主请求不含对冲中落败的尝试
+func CompareShadow(ctx context.Context, model string, since time.Time) (ShadowComparison, error) {
+	comparison := ShadowComparison{Model: model, Since: since, Shadows: make([]ShadowStats, 0)}
+	if err := models.DB.WithContext(ctx).Model(&models.ChatLog{}).
+		Select(shadowStatsColumns).
+		Where("name = ? AND created_at > ? AND status <> ?", model, since, "hedged").
+		Scan(&comparison.Primary).Error; err != nil {
+		return comparison, err
+	}
+	if err := models.DB.WithContext(ctx).Model(&models.ShadowLog{}).
+		Select("provider_name, provider_model, "+shadowStatsColumns).
+		Where("name = ? AND created_at > ?", model, since).
+		Group("provider_name, provider_model").
+		Scan(&comparison.Shadows).Error; err != nil {
+		return comparison, err
+	}
+	comparison.Primary.finish()
+	for i := range comparison.Shadows {
+		comparison.Shadows[i].finish()
+	}
+	return comparison, nil
+}
+
+// finish 计算错误率 并将首字时间由纳秒换算为毫秒
+func (s *ShadowStats) finish() {
+	if s.Requests > 0 {
+		s.ErrorRate = float64(s.Errors) / float64(s.Requests)
+	}
+	s.AvgTTFT /= float64(time.Millisecond)
+}
@@ -0,0 +1,211 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/atopos31/llmio/models"
+	"gorm.io/gorm"
+)
+
+const (
+	// routingStatsTTL 近期表现统计的缓存时间
+	routingStatsTTL = time.Minute
+	// routingMinSamples 样本少于该值时不调整权重
+	routingMinSamples = 5
+	// smartWeightScale 调整前先将权重放大的倍数 避免默认权重1乘以因子后被取整回1
+	smartWeightScale = 100
+)
+
+var (
+	systemConfigMu sync.RWMutex
+	systemConfig   *models.SystemConfig
+)
+
+// GetSystemConfig 获取系统配置 首次读取后缓存在内存中
+func GetSystemConfig(ctx context.Context) (models.SystemConfig, error) {
+	systemConfigMu.RLock()
+	cached := systemConfig
+	systemConfigMu.RUnlock()
+	if cached != nil {
+		return *cached, nil
+	}
+
+	config, err := gorm.G[models.SystemConfig](models.DB).First(ctx)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		config = models.DefaultSystemConfig()
+	} else if err != nil {
+		return models.SystemConfig{}, err
+	}
+	systemConfigMu.Lock()
+	systemConfig = &config
+	systemConfigMu.Unlock()
+	return config, nil
+}
+
+// SaveSystemConfig 持久化系统配置并刷新内存缓存
+func SaveSystemConfig(ctx context.Context, update models.SystemConfig) (models.SystemConfig, error) {
+	config, err := gorm.G[models.SystemConfig](models.DB).First(ctx)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		config = models.DefaultSystemConfig()
+	} else if err != nil {
+		return models.SystemConfig{}, err
+	}
+	config.EnableSmartRouting = update.EnableSmartRouting
+	config.SuccessRateWeight = update.SuccessRateWeight
+	config.ResponseTimeWeight = update.ResponseTimeWeight
+	config.DecayThresholdHours = update.DecayThresholdHours
+	config.MinWeight = update.MinWeight
+	config.QueueSize = update.QueueSize
+	config.QueuePriorities = update.QueuePriorities
+	config.CanaryMaxErrorRateDelta = update.CanaryMaxErrorRateDelta
+	config.CanaryMaxTTFTRatio = update.CanaryMaxTTFTRatio
+	config.CanaryMinSamples = update.CanaryMinSamples
+	// Save会写入零值(如关闭智能路由)
+	if err := models.DB.WithContext(ctx).Save(&config).Error; err != nil {
+		return models.SystemConfig{}, err
+	}
+
+	systemConfigMu.Lock()
+	systemConfig = &config
+	systemConfigMu.Unlock()
+	routingStatsCache.invalidate()
+	return config, nil
+}
+
+// routingStat 一个提供商模型在统计窗口内的表现
+type routingStat struct {
+	Total   int64
+	Success int64
+	AvgTTFT float64 // 成功请求的平均首字时间(纳秒) 没有样本时为0
+}
+
+// routingStatKey 日志中以提供商名称与提供商模型标识一个关联
+type routingStatKey struct {
+	providerName  string
+	providerModel string
+}
+
+// routingStats 按统计窗口缓存的近期表现
+type routingStats struct {
+	mu        sync.Mutex
+	window    time.Duration
+	stats     map[routingStatKey]routingStat
+	refreshAt time.Time
+}
+
+var routingStatsCache = &routingStats{}
+
+func (r *routingStats) invalidate() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.refreshAt = time.Time{}
+}
+
+// get 返回统计窗口内各关联的表现 过期时重新查询
+func (r *routingStats) get(ctx context.Context, window time.Duration) (map[routingStatKey]routingStat, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stats != nil && r.window == window && time.Now().Before(r.refreshAt) {
+		return r.stats, nil
+	}
+
+	var rows []struct {
+		ProviderName  string
+		ProviderModel string
+		Total         int64
+		Success       int64
+		AvgTTFT       *float64
+	}
+	err := models.DB.WithContext(ctx).Model(&models.ChatLog{}).
+		Select(`provider_name, provider_model, COUNT(*) as total,
+			SUM(CASE WHEN status = 'success' THEN 1 ELSE 0 END) as success,
+			AVG(CASE WHEN status = 'success' AND first_chunk_time > 0 THEN first_chunk_time END) as avg_ttft`).
+		Where("created_at > ? AND status <> ?", time.Now().Add(-window), "hedged").
+		Group("provider_name, provider_model").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make(map[routingStatKey]routingStat, len(rows))
+	for _, row := range rows {
+		stat := routingStat{Total: row.Total, Success: row.Success}
+		if row.AvgTTFT != nil {
+			stat.AvgTTFT = *row.AvgTTFT
+		}
+		stats[routingStatKey{row.ProviderName, row.ProviderModel}] = stat
+	}
+	r.stats = stats
+	r.window = window
+	r.refreshAt = time.Now().Add(routingStatsTTL)
+	return stats, nil
+}
+
+// routingCandidate 参与智能路由的关联
+type routingCandidate struct {
+	providerName  string
+	providerModel string
+}
+
+// smartWeights 根据近期成功率与响应时间计算有效权重
+// 因子 = (成功率*success_rate_weight + 响应时间得分*response_time_weight) / 两者之和
+// 响应时间得分为候选中最快的平均首字时间与自身的比值 样本不足的一项按1计
+// 有效权重 = max(min_weight, 原权重*因子) 原权重不大于0的关联保持不变
+// 原权重先放大smartWeightScale倍再乘以因子 min_weight按放大后的权重比较
+func smartWeights(config models.SystemConfig, items map[uint]int, candidates map[uint]routingCandidate, stats map[routingStatKey]routingStat) map[uint]int {
+	totalWeight := config.SuccessRateWeight + config.ResponseTimeWeight
+	if totalWeight <= 0 {
+		return items
+	}
+
+	fastest := math.Inf(1)
+	for id := range items {
+		stat := stats[routingStatKey{candidates[id].providerName, candidates[id].providerModel}]
+		if stat.Success >= routingMinSamples && stat.AvgTTFT > 0 {
+			fastest = min(fastest, stat.AvgTTFT)
+		}
+	}
+
+	weights := make(map[uint]int, len(items))
+	for id, weight := range items {
+		if weight <= 0 {
+			weights[id] = weight
+			continue
+		}
+		stat := stats[routingStatKey{candidates[id].providerName, candidates[id].providerModel}]
+		successScore := 1.0
+		if stat.Total >= routingMinSamples {
+			successScore = float64(stat.Success) / float64(stat.Total)
+		}
+		latencyScore := 1.0
+		if stat.Success >= routingMinSamples && stat.AvgTTFT > 0 && !math.IsInf(fastest, 1) {
+			latencyScore = fastest / stat.AvgTTFT
+		}
+		factor := (successScore*config.SuccessRateWeight + latencyScore*config.ResponseTimeWeight) / totalWeight
+		weights[id] = max(config.MinWeight, int(math.Round(float64(weight*smartWeightScale)*factor)))
+	}
+	return weights
+}
+
+// applySmartRouting 若开启智能路由 返回按近期表现调整后的权重 出错时保持原权重
+func applySmartRouting(ctx context.Context, items map[uint]int, candidates map[uint]routingCandidate) map[uint]int {
+	config, err := GetSystemConfig(ctx)
+	if err != nil {
+		slog.Warn("get system config error", "error", err)
+		return items
+	}
+	if !config.EnableSmartRouting || config.DecayThresholdHours <= 0 {
+		return items
+	}
+	stats, err := routingStatsCache.get(ctx, time.Duration(config.DecayThresholdHours)*time.Hour)
+	if err != nil {
+		slog.Warn("get routing stats error", "error", err)
+		return items
+	}
+	return smartWeights(config, items, candidates, stats)
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/atopos31/llmio/balancer"
+	"github.com/atopos31/llmio/models"
+	"gorm.io/gorm"
+)
+
+func TestSmartWeights(t *testing.T) {
+	config := models.DefaultSystemConfig()
+	items := map[uint]int{1: 10, 2: 10, 3: 10}
+	candidates := map[uint]routingCandidate{
+		1: {"fast", "m"},
+		2: {"flaky", "m"},
+		3: {"new", "m"},
+	}
+	stats := map[routingStatKey]routingStat{
+		{"fast", "m"}:  {Total: 10, Success: 10, AvgTTFT: float64(time.Second)},
+		{"flaky", "m"}: {Total: 10, Success: 5, AvgTTFT: float64(2 * time.Second)},
+		{"new", "m"}:   {Total: 2, Success: 2, AvgTTFT: float64(5 * time.Second)},
+	}
+
+	weights := smartWeights(config, items, candidates, stats)
+	// 权重统一放大100倍
+	if weights[1] != 1000 {
+		t.Errorf("fast provider weight = %d, want 1000", weights[1])
+	}
+	// 0.7*0.5 + 0.3*0.5 = 0.5
+	if weights[2] != 500 {
+		t.Errorf("flaky provider weight = %d, want 500", weights[2])
+	}
+	// 样本不足 保持原权重
+	if weights[3] != 1000 {
+		t.Errorf("new provider weight = %d, want 1000", weights[3])
+	}
+
+	config.MinWeight = 800
+	if weights := smartWeights(config, items, candidates, stats); weights[2] != 800 {
+		t.Errorf("min weight not applied: %d", weights[2])
+	}
+}
+
+// TestSmartWeightsDefaultWeight 默认权重1时 更快更稳定的关联也应分到更多流量
+func TestSmartWeightsDefaultWeight(t *testing.T) {
+	config := models.DefaultSystemConfig()
+	items := map[uint]int{1: 1, 2: 1}
+	candidates := map[uint]routingCandidate{
+		1: {"fast", "m"},
+		2: {"slow", "m"},
+	}
+	stats := map[routingStatKey]routingStat{
+		{"fast", "m"}: {Total: 10, Success: 10, AvgTTFT: float64(time.Second)},
+		{"slow", "m"}: {Total: 10, Success: 8, AvgTTFT: float64(2 * time.Second)},
+	}
+
+	weights := smartWeights(config, items, candidates, stats)
+	// 0.7*0.8 + 0.3*0.5 = 0.71
+	if weights[1] != 100 || weights[2] != 71 {
+		t.Fatalf("weights = %v, want fast 100 slow 71", weights)
+	}
+
+	picks := map[uint]int{}
+	for range 10000 {
+		item, err := balancer.WeightedRandom(weights)
+		if err != nil {
+			t.Fatal(err)
+		}
+		picks[*item]++
+	}
+	if picks[1] <= picks[2] {
+		t.Errorf("fast provider picked %d times, slow provider %d times", picks[1], picks[2])
+	}
+}
+
+// TestSaveSystemConfigZeroValues 首次保存时零值也应写入 而不是被默认值替换
+func TestSaveSystemConfigZeroValues(t *testing.T) {
+	initChatTest(t)
+	if err := models.DB.Where("1 = 1").Delete(&models.SystemConfig{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	update := models.DefaultSystemConfig()
+	update.EnableSmartRouting = false
+	update.MinWeight = 0
+	update.QueueSize = 0
+	if _, err := SaveSystemConfig(t.Context(), update); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := gorm.G[models.SystemConfig](models.DB).First(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.EnableSmartRouting || saved.MinWeight != 0 || saved.QueueSize != 0 {
+		t.Errorf("zero values not saved: %+v", saved)
+	}
+	if saved.SuccessRateWeight != 0.7 || saved.CanaryMinSamples != 20 {
+		t.Errorf("defaults not kept: %+v", saved)
+	}
+}
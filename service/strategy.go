@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+	"sync"
+
+	"github.com/atopos31/llmio/balancer"
+	"github.com/atopos31/llmio/models"
+)
+
+// latencyAlpha 响应时间移动平均中新样本的权重
+const latencyAlpha = 0.3
+
+var (
+	// inFlight 各模型提供商关联正在处理的请求数
+	inFlight = balancer.NewInFlight[uint]()
+	// latency 各模型提供商关联的响应时间移动平均
+	latency = balancer.NewLatency[uint](latencyAlpha)
+	// roundRobins 模型名称 -> 平滑加权轮询状态
+	roundRobins sync.Map
+)
+
+// strategyFor 返回模型配置的负载均衡策略 候选项为模型提供商关联ID
+// providerOf 将关联ID映射到提供商ID 供按提供商用量选择的策略使用
+// costOf 为各关联对本次请求的预估费用 供按费用选择的策略使用
+func strategyFor(ctx context.Context, modelName, strategy string, providerOf map[uint]uint, costOf map[uint]float64) balancer.Strategy[uint] {
+	switch strategy {
+	case balancer.StrategySmoothRoundRobin:
+		rr, _ := roundRobins.LoadOrStore(modelName, balancer.NewSmoothRoundRobin[uint]())
+		return rr.(*balancer.SmoothRoundRobin[uint])
+	case balancer.StrategyLeastInFlight:
+		return balancer.LeastInFlight[uint]{InFlight: inFlight}
+	case balancer.StrategyLeastUsed:
+		return balancer.LeastUsed[uint]{Usage: func(keys []uint) (map[uint]int64, error) {
+			providerIDs := make([]uint, 0, len(keys))
+			for _, key := range keys {
+				providerIDs = append(providerIDs, providerOf[key])
+			}
+			usage, err := GetProvidersUsageToday(ctx, models.DB, providerIDs)
+			if err != nil {
+				return nil, err
+			}
+			result := make(map[uint]int64, len(keys))
+			for _, key := range keys {
+				result[key] = usage[providerOf[key]]
+			}
+			return result, nil
+		}}
+	case balancer.StrategyLowestLatency:
+		return balancer.LowestLatency[uint]{Latency: latency}
+	case balancer.StrategyCheapest:
+		return balancer.Cheapest[uint]{Cost: func(key uint) float64 { return costOf[key] }}
+	default:
+		return balancer.WeightedRandomStrategy[uint]{}
+	}
+}
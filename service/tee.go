@@ -22,9 +22,20 @@
 	MaxScannerBufferSize  = 1024 * 1024 * 15 // 15MB
 )
 
-type Processer func(ctx context.Context, pr io.ReadCloser, stream bool, logId uint, start time.Time)
+// Processer 处理响应数据流并更新日志 返回解析出的用量、耗时与错误
+// logId为0时只解析不写入日志
+type Processer func(ctx context.Context, pr io.ReadCloser, stream bool, logId uint, start time.Time) models.ChatLog
 
-func ProcesserOpenAI(ctx context.Context, pr io.ReadCloser, stream bool, logId uint, start time.Time) {
+func updateChatLog(ctx context.Context, logId uint, log models.ChatLog) {
+	if logId == 0 {
+		return
+	}
+	if _, err := gorm.G[models.ChatLog](models.DB).Where("id = ?", logId).Updates(ctx, log); err != nil {
+		slog.Error("update chat log error", "error", err)
+	}
+}
+
+func ProcesserOpenAI(ctx context.Context, pr io.ReadCloser, stream bool, logId uint, start time.Time) models.ChatLog {
 	// 首字时延
 	var firstChunkTime time.Duration
 	var once sync.Once
@@ -66,6 +77,7 @@ func ProcesserOpenAI(ctx context.Context, pr io.ReadCloser, stream bool, logId u
 		if err := json.Unmarshal([]byte(usageStr.Raw), &usage); err != nil {
 			slog.Error("unmarshal usage error, raw:" + usageStr.Raw)
 		}
+		usage.CachedTokens = usageStr.Get("prompt_tokens_details.cached_tokens").Int()
 	}
 
 	// tps
@@ -84,10 +96,9 @@ func ProcesserOpenAI(ctx context.Context, pr io.ReadCloser, stream bool, logId u
 		log = log.WithError(chunkErr)
 	}
 
-	if _, err := gorm.G[models.ChatLog](models.DB).Where("id = ?", logId).Updates(ctx, log); err != nil {
-		slog.Error("update chat log error", "error", err)
-	}
+	updateChatLog(ctx, logId, log)
 	slog.Info("response", "input", usage.PromptTokens, "output", usage.CompletionTokens, "total", usage.TotalTokens, "firstChunkTime", firstChunkTime, "chunkTime", chunkTime, "tps", tps)
+	return log
 }
 
 type AnthropicUsage struct {
@@ -98,7 +109,7 @@ type AnthropicUsage struct {
 	ServiceTier              string `json:"service_tier"`
 }
 
-func ProcesserAnthropic(ctx context.Context, pr io.ReadCloser, stream bool, logId uint, start time.Time) {
+func ProcesserAnthropic(ctx context.Context, pr io.ReadCloser, stream bool, logId uint, start time.Time) models.ChatLog {
 	// 首字时延
 	var firstChunkTime time.Duration
 	var once sync.Once
@@ -135,9 +146,11 @@ func ProcesserAnthropic(ctx context.Context, pr io.ReadCloser, stream bool, logI
 	}
 
 	usage := models.Usage{
-		PromptTokens:     athropicUsage.InputTokens,
-		CompletionTokens: athropicUsage.OutputTokens,
-		TotalTokens:      totalTokens,
+		PromptTokens:        athropicUsage.InputTokens,
+		CompletionTokens:    athropicUsage.OutputTokens,
+		TotalTokens:         totalTokens,
+		CacheCreationTokens: athropicUsage.CacheCreationInputTokens,
+		CacheReadTokens:     athropicUsage.CacheReadInputTokens,
 	}
 
 	log := models.ChatLog{
@@ -152,10 +165,124 @@ func ProcesserAnthropic(ctx context.Context, pr io.ReadCloser, stream bool, logI
 	if chunkErr != nil {
 		log = log.WithError(chunkErr)
 	}
-	if _, err := gorm.G[models.ChatLog](models.DB).Where("id = ?", logId).Updates(ctx, log); err != nil {
-		slog.Error("update chat log error", "error", err)
+	updateChatLog(ctx, logId, log)
+	slog.Info("response", "input", usage.PromptTokens, "output", usage.CompletionTokens, "total", usage.TotalTokens, "firstChunkTime", firstChunkTime, "chunkTime", chunkTime, "tps", tps)
+	return log
+}
+
+type ResponsesUsage struct {
+	InputTokens  int64 `json:"input_tokens"`
+	OutputTokens int64 `json:"output_tokens"`
+	TotalTokens  int64 `json:"total_tokens"`
+}
+
+func ProcesserResponses(ctx context.Context, pr io.ReadCloser, stream bool, logId uint, start time.Time) models.ChatLog {
+	// 首字时延
+	var firstChunkTime time.Duration
+	var once sync.Once
+	var chunkErr error
+
+	var usageStr string
+
+	scanner := bufio.NewScanner(pr)
+	scanner.Buffer(make([]byte, 0, InitScannerBufferSize), MaxScannerBufferSize)
+	for chunk := range ScannerToken(scanner) {
+		if !stream {
+			once.Do(func() {
+				firstChunkTime = time.Since(start)
+			})
+			usageStr = gjson.Get(chunk, "usage").Raw
+			continue
+		}
+		if !strings.HasPrefix(chunk, "data: ") {
+			continue
+		}
+		content := strings.TrimPrefix(chunk, "data: ")
+		switch eventType := gjson.Get(content, "type").String(); eventType {
+		case "response.output_text.delta", "response.function_call_arguments.delta":
+			once.Do(func() {
+				firstChunkTime = time.Since(start)
+			})
+		case "response.completed", "response.incomplete":
+			usageStr = gjson.Get(content, "response.usage").Raw
+		case "response.failed":
+			chunkErr = errors.New(gjson.Get(content, "response.error.message").String())
+		case "error":
+			chunkErr = errors.New(gjson.Get(content, "message").String())
+		}
+	}
+	// 没有输出增量时以响应结束时间作为首字时延
+	once.Do(func() {
+		firstChunkTime = time.Since(start)
+	})
+	var responsesUsage ResponsesUsage
+	if usageStr != "" {
+		if err := json.Unmarshal([]byte(usageStr), &responsesUsage); err != nil {
+			slog.Error("unmarshal usage error, raw:" + usageStr)
+		}
 	}
+	if responsesUsage.TotalTokens == 0 {
+		responsesUsage.TotalTokens = responsesUsage.InputTokens + responsesUsage.OutputTokens
+	}
+	// 耗时
+	chunkTime := time.Since(start) - firstChunkTime
+	// tps
+	var tps float64
+	if stream {
+		tps = float64(responsesUsage.TotalTokens) / chunkTime.Seconds()
+	}
+
+	usage := models.Usage{
+		PromptTokens:     responsesUsage.InputTokens,
+		CompletionTokens: responsesUsage.OutputTokens,
+		TotalTokens:      responsesUsage.TotalTokens,
+		CachedTokens:     gjson.Get(usageStr, "input_tokens_details.cached_tokens").Int(),
+	}
+
+	log := models.ChatLog{
+		Usage:          usage,
+		ChunkTime:      chunkTime,
+		Tps:            tps,
+		FirstChunkTime: firstChunkTime,
+	}
+	if err := scanner.Err(); err != nil {
+		chunkErr = err
+	}
+	if chunkErr != nil {
+		log = log.WithError(chunkErr)
+	}
+	updateChatLog(ctx, logId, log)
 	slog.Info("response", "input", usage.PromptTokens, "output", usage.CompletionTokens, "total", usage.TotalTokens, "firstChunkTime", firstChunkTime, "chunkTime", chunkTime, "tps", tps)
+	return log
+}
+
+func ProcesserEmbeddings(ctx context.Context, pr io.ReadCloser, _ bool, logId uint, start time.Time) models.ChatLog {
+	body, err := io.ReadAll(pr)
+	// embeddings为一次性响应 首字时延即完整响应耗时
+	firstChunkTime := time.Since(start)
+
+	var usage models.Usage
+	usageStr := gjson.GetBytes(body, "usage")
+	if usageStr.Exists() {
+		if err := json.Unmarshal([]byte(usageStr.Raw), &usage); err != nil {
+			slog.Error("unmarshal usage error, raw:" + usageStr.Raw)
+		}
+	}
+	// embeddings没有输出token
+	if usage.TotalTokens == 0 {
+		usage.TotalTokens = usage.PromptTokens
+	}
+
+	log := models.ChatLog{
+		Usage:          usage,
+		FirstChunkTime: firstChunkTime,
+	}
+	if err != nil {
+		log = log.WithError(err)
+	}
+	updateChatLog(ctx, logId, log)
+	slog.Info("response", "input", usage.PromptTokens, "total", usage.TotalTokens, "firstChunkTime", firstChunkTime)
+	return log
 }
 
 func ScannerToken(reader *bufio.Scanner) iter.Seq[string] {
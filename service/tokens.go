@@ -0,0 +1,73 @@
+package service
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/tidwall/gjson"
+)
+
+const (
+	// messageTokenOverhead 每条消息(或输入项、工具定义)的结构开销
+	messageTokenOverhead = 4
+	// imageTokens 单张图片按该值估算 实际开销取决于分辨率与上游
+	imageTokens = 1000
+)
+
+// estimateTokens 粗略估算请求中各路径下内容的token数 不依赖具体模型的分词器
+// 英文约4个字符一个token 中日韩等非ASCII字符按每字一个token计
+func estimateTokens(data []byte, paths ...string) int {
+	tokens := 0
+	for _, path := range paths {
+		value := gjson.GetBytes(data, path)
+		if value.IsArray() {
+			tokens += len(value.Array()) * messageTokenOverhead
+		}
+		tokens += estimateValueTokens("", value)
+	}
+	return tokens
+}
+
+func estimateValueTokens(key string, value gjson.Result) int {
+	switch {
+	case value.IsObject(), value.IsArray():
+		tokens := 0
+		value.ForEach(func(k, v gjson.Result) bool {
+			tokens += estimateValueTokens(k.String(), v)
+			return true
+		})
+		return tokens
+	case value.Type == gjson.String:
+		text := value.String()
+		// 内联的图片与文件按固定开销计 不按base64长度计
+		if key == "data" || strings.HasPrefix(text, "data:") {
+			return imageTokens
+		}
+		if key == "image_url" || (key == "url" && strings.HasPrefix(text, "http")) {
+			return imageTokens
+		}
+		return estimateTextTokens(text)
+	default:
+		return 0
+	}
+}
+
+func estimateTextTokens(text string) int {
+	ascii, other := 0, 0
+	for _, r := range text {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return (ascii+3)/4 + other
+}
+
+// fits 关联的上下文窗口与最大输出能否容纳请求 未配置的限制不做检查
+func fits(promptTokens, maxTokens, contextWindow, maxOutputTokens int) bool {
+	if maxOutputTokens > 0 && maxTokens > maxOutputTokens {
+		return false
+	}
+	return contextWindow <= 0 || promptTokens+maxTokens <= contextWindow
+}
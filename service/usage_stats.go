@@ -111,30 +111,39 @@ func GetProviderSuccessRate(ctx context.Context, db *gorm.DB, providerID uint, d
 	return float64(successRequests) / float64(totalRequests) * 100, nil
 }
 
-// SelectLeastUsedProvider 选择使用最少的提供商
-func SelectLeastUsedProvider(ctx context.Context, db *gorm.DB, providerIDs []uint) (uint, error) {
-	if len(providerIDs) == 0 {
-		return 0, gorm.ErrRecordNotFound
-	}
-	
+// GetProvidersUsageToday 获取各提供商今日的请求数 没有记录的提供商为0
+func GetProvidersUsageToday(ctx context.Context, db *gorm.DB, providerIDs []uint) (map[uint]int64, error) {
 	today := time.Now().Truncate(24 * time.Hour)
-	
+
 	// 查询今日各提供商的使用统计
 	var stats []models.ProviderUsageStats
 	err := db.Where("provider_id IN ? AND date = ?", providerIDs, today).Find(&stats).Error
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	
+
 	// 创建使用次数映射
-	usageMap := make(map[uint]int64)
+	usageMap := make(map[uint]int64, len(providerIDs))
 	for _, id := range providerIDs {
 		usageMap[id] = 0
 	}
-	
+
 	for _, stat := range stats {
 		usageMap[stat.ProviderID] = stat.TotalRequests
 	}
+	return usageMap, nil
+}
+
+// SelectLeastUsedProvider 选择使用最少的提供商
+func SelectLeastUsedProvider(ctx context.Context, db *gorm.DB, providerIDs []uint) (uint, error) {
+	if len(providerIDs) == 0 {
+		return 0, gorm.ErrRecordNotFound
+	}
+	
+	usageMap, err := GetProvidersUsageToday(ctx, db, providerIDs)
+	if err != nil {
+		return 0, err
+	}
 	
 	// 找到使用次数最少的提供商
 	var minUsage int64 = -1